@@ -0,0 +1,268 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultMediaMaxSize - media larger than this is not downloaded automatically
+// unless MaxSize is set
+const DefaultMediaMaxSize = 64 * 1024 * 1024
+
+// autoDownloadQueueSize - how many messages can wait for the media download
+const autoDownloadQueueSize = 100
+
+// autoDownloadWorkers - how many media are downloaded at once
+const autoDownloadWorkers = 3
+
+// autoDownloadTimeout - the download is abandoned after
+const autoDownloadTimeout = 5 * time.Minute
+
+var ErrInvalidPathName = errors.New("invalid name for the media path")
+
+// MediaStorage saves the media downloaded automatically
+type MediaStorage interface {
+	// Save saves the content and returns where it's stored
+	Save(session string, info types.MessageInfo, mimetype string, content io.Reader) (string, error)
+}
+
+// LocalMediaStorage saves media to {Dir}/{session}/{message id}.{ext}
+type LocalMediaStorage struct {
+	Dir string
+}
+
+func (ls *LocalMediaStorage) Save(session string, info types.MessageInfo, mimetype string, content io.Reader) (string, error) {
+	err := ValidatePathName(session)
+	if err != nil {
+		return "", err
+	}
+	err = ValidatePathName(info.ID)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(ls.Dir, session)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, info.ID+mediaExtension(mimetype))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// ValidatePathName checks the name can be used as a single path element,
+// so it can't point outside the media directory
+func ValidatePathName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: '%s'", ErrInvalidPathName, name)
+	}
+	return nil
+}
+
+func mediaExtension(mimetype string) string {
+	mediaType, _, err := mime.ParseMediaType(mimetype)
+	if err != nil {
+		return ""
+	}
+	extensions, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(extensions) == 0 {
+		return ""
+	}
+	return extensions[0]
+}
+
+// MediaDownloadedEventData is issued after the message event
+// when its media is downloaded automatically
+type MediaDownloadedEventData struct {
+	Info     types.MessageInfo
+	Path     string
+	Mimetype string
+	Size     uint64
+}
+
+type mediaWithMimetype interface {
+	GetMimetype() string
+}
+
+type mediaWithLength interface {
+	GetFileLength() uint64
+}
+
+// maxSize is the size limit for the automatic download
+func (cfg *MediaConfig) maxSize() uint64 {
+	if cfg.MaxSize == 0 {
+		return DefaultMediaMaxSize
+	}
+	return cfg.MaxSize
+}
+
+// shouldDownload checks the media against mimetype and size filters
+func (cfg *MediaConfig) shouldDownload(mimetype string, size uint64) bool {
+	if size > cfg.maxSize() {
+		return false
+	}
+	if len(cfg.Mimetypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(mimetype)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range cfg.Mimetypes {
+		if pattern == mediaType {
+			return true
+		}
+		// image/* matches all images
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// autoDownloadEnabled checks if incoming media are downloaded for the session
+func (gows *GoWS) autoDownloadEnabled() bool {
+	cfg := gows.media
+	return cfg != nil && cfg.AutoDownload && cfg.Storage != nil
+}
+
+// startAutoDownload starts the workers that download incoming media,
+// so the downloads don't block the event handler
+func (gows *GoWS) startAutoDownload() {
+	gows.downloads = make(chan *events.Message, autoDownloadQueueSize)
+	for range autoDownloadWorkers {
+		gows.downloadsDone.Add(1)
+		go func() {
+			defer gows.downloadsDone.Done()
+			for {
+				select {
+				case <-gows.Context.Done():
+					return
+				case evt := <-gows.downloads:
+					if downloaded := gows.autoDownload(evt); downloaded != nil {
+						gows.emit(downloaded)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// queueAutoDownload passes the message to the download workers if it has media to download.
+// MediaDownloadedEventData is issued once the media is saved
+func (gows *GoWS) queueAutoDownload(evt *events.Message) {
+	if !gows.autoDownloadEnabled() || evt.Info.IsFromMe {
+		return
+	}
+	downloadable := getDownloadable(evt.Message)
+	if downloadable == nil {
+		return
+	}
+	var mimetype string
+	if media, ok := downloadable.(mediaWithMimetype); ok {
+		mimetype = media.GetMimetype()
+	}
+	var size uint64
+	if media, ok := downloadable.(mediaWithLength); ok {
+		size = media.GetFileLength()
+	}
+	if !gows.media.shouldDownload(mimetype, size) {
+		return
+	}
+	select {
+	case gows.downloads <- evt:
+	default:
+		gows.Log.Warnf("Too many media downloads in the queue, skipping media for %s", evt.Info.ID)
+	}
+}
+
+// autoDownload downloads the media to a temp file and passes it to the storage
+func (gows *GoWS) autoDownload(evt *events.Message) *MediaDownloadedEventData {
+	downloadable := getDownloadable(evt.Message)
+	var mimetype string
+	if media, ok := downloadable.(mediaWithMimetype); ok {
+		mimetype = media.GetMimetype()
+	}
+
+	ctx, cancel := context.WithTimeout(gows.Context, autoDownloadTimeout)
+	defer cancel()
+	file, err := gows.downloadToTemp(ctx, downloadable)
+	if err != nil {
+		gows.Log.Errorf("Failed to download media for %s: %v", evt.Info.ID, err)
+		return nil
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		gows.Log.Errorf("Failed to read media for %s: %v", evt.Info.ID, err)
+		return nil
+	}
+	session, _ := gows.Context.Value("name").(string)
+	path, err := gows.media.Storage.Save(session, evt.Info, mimetype, file)
+	if err != nil {
+		gows.Log.Errorf("Failed to save media for %s: %v", evt.Info.ID, err)
+		return nil
+	}
+	return &MediaDownloadedEventData{
+		Info:     evt.Info,
+		Path:     path,
+		Mimetype: mimetype,
+		Size:     uint64(stat.Size()),
+	}
+}
+
+// downloadToTemp downloads the media into a new temp file positioned at the start.
+// whatsmeow downloads can't be cancelled, so on timeout the download is abandoned
+// and removes its file when it's over
+func (gows *GoWS) downloadToTemp(ctx context.Context, downloadable whatsmeow.DownloadableMessage) (*os.File, error) {
+	file, err := os.CreateTemp("", "gows-media-*")
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- gows.DownloadToFile(downloadable, file)
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		go func() {
+			<-done
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}()
+		return nil, ctx.Err()
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
@@ -2,6 +2,7 @@ package gows
 
 import (
 	"context"
+	"database/sql"
 	_ "github.com/lib/pq"           // Import the Postgres drive
 	_ "github.com/mattn/go-sqlite3" // Import the SQLite drive
 	"go.mau.fi/whatsmeow"
@@ -10,6 +11,7 @@ import (
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
+	"sync"
 )
 
 // GoWS it's Go WebSocket or WhatSapp ;)
@@ -20,23 +22,57 @@ type GoWS struct {
 
 	cancelContext context.CancelFunc
 	container     *sqlstore.Container
+	polls         *pollStore
+	mediaRetries  *mediaRetryStore
+	media         *MediaConfig
+	downloads     chan *events.Message
+	downloadsDone sync.WaitGroup
 }
 
 func (gows *GoWS) handleEvent(event interface{}) {
 	var data interface{}
-	switch event.(type) {
+	switch evt := event.(type) {
 	case *events.Connected:
 		// Populate the ConnectedEventData with the ID and PushName
 		data = &ConnectedEventData{
 			ID:       gows.Store.ID,
 			PushName: gows.Store.PushName,
 		}
+	case *events.Message:
+		err := gows.polls.rememberPoll(evt)
+		if err != nil {
+			gows.Log.Errorf("Failed to save poll %s: %v", evt.Info.ID, err)
+		}
+		data = event
+		if evt.Message.GetPollUpdateMessage() != nil {
+			vote, err := gows.decryptPollVote(evt)
+			if err != nil {
+				gows.Log.Errorf("Failed to decrypt poll vote: %v", err)
+			} else {
+				data = vote
+			}
+		} else {
+			gows.queueAutoDownload(evt)
+		}
+	case *events.MediaRetry:
+		gows.mediaRetries.resolve(evt)
+		data = event
 
 	default:
 		data = event
 	}
+	gows.emit(data)
+
+	// Issue stable gows events derived from whatsmeow ones
+	if evt, ok := event.(*events.GroupInfo); ok {
+		for _, groupEvent := range buildGroupEvents(evt) {
+			gows.emit(groupEvent)
+		}
+	}
+}
 
-	// reissue from events to client
+// emit reissues the event to the client
+func (gows *GoWS) emit(data interface{}) {
 	select {
 	case <-gows.Context.Done():
 		return
@@ -45,6 +81,9 @@ func (gows *GoWS) handleEvent(event interface{}) {
 }
 
 func (gows *GoWS) Start() error {
+	if gows.autoDownloadEnabled() {
+		gows.startAutoDownload()
+	}
 	gows.AddEventHandler(gows.handleEvent)
 
 	// Not connected, listen for QR code events
@@ -79,6 +118,8 @@ func (gows *GoWS) listenQRCodeEvents() {
 func (gows *GoWS) Stop() {
 	gows.Disconnect()
 	gows.cancelContext()
+	// The download workers may still emit the events
+	gows.downloadsDone.Wait()
 	err := gows.container.Close()
 	if err != nil {
 		gows.Log.Errorf("Error closing container: %v", err)
@@ -104,8 +145,14 @@ type ConnectedEventData struct {
 
 func BuildSession(ctx context.Context, log waLog.Logger, dialect string, address string) (*GoWS, error) {
 	// Prepare the database
-	container, err := sqlstore.New(dialect, address, log.Sub("Database"))
+	db, err := sql.Open(dialect, address)
+	if err != nil {
+		return nil, err
+	}
+	container := sqlstore.NewWithDB(db, dialect, log.Sub("Database"))
+	err = container.Upgrade()
 	if err != nil {
+		_ = container.Close()
 		return nil, err
 	}
 	deviceStore, err := container.GetFirstDevice()
@@ -113,6 +160,11 @@ func BuildSession(ctx context.Context, log waLog.Logger, dialect string, address
 		_ = container.Close()
 		return nil, err
 	}
+	polls, err := newPollStore(db)
+	if err != nil {
+		_ = container.Close()
+		return nil, err
+	}
 
 	// Configure the client
 	client := whatsmeow.NewClient(deviceStore, log.Sub("Client"))
@@ -126,6 +178,11 @@ func BuildSession(ctx context.Context, log waLog.Logger, dialect string, address
 		make(chan interface{}, 10),
 		cancel,
 		container,
+		polls,
+		newMediaRetryStore(),
+		nil,
+		nil,
+		sync.WaitGroup{},
 	}
 	return &gows, nil
 }
@@ -149,8 +206,32 @@ func (gows *GoWS) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Mess
 		ID:        resp.ID,
 		Timestamp: resp.Timestamp,
 		ServerID:  resp.ServerID,
+		Edit:      getEditAttribute(msg),
 	}
-	evt := &events.Message{Info: *info, Message: msg, RawMessage: msg}
+	evt := &events.Message{Info: *info, RawMessage: msg}
+	// Unwrap edits the same way as for incoming messages
+	evt.UnwrapRaw()
 	go gows.handleEvent(evt)
 	return
 }
+
+// getEditAttribute gets the edit attribute for the sent message, the same as whatsmeow sends
+func getEditAttribute(msg *waE2E.Message) types.EditAttribute {
+	switch {
+	case msg.EditedMessage != nil && msg.EditedMessage.Message != nil:
+		return getEditAttribute(msg.EditedMessage.Message)
+	case msg.ProtocolMessage != nil && msg.ProtocolMessage.GetKey() != nil:
+		switch msg.ProtocolMessage.GetType() {
+		case waE2E.ProtocolMessage_REVOKE:
+			if msg.ProtocolMessage.GetKey().GetFromMe() {
+				return types.EditAttributeSenderRevoke
+			}
+			return types.EditAttributeAdminRevoke
+		case waE2E.ProtocolMessage_MESSAGE_EDIT:
+			if msg.ProtocolMessage.EditedMessage != nil {
+				return types.EditAttributeMessageEdit
+			}
+		}
+	}
+	return types.EditAttributeEmpty
+}
@@ -0,0 +1,93 @@
+package gows
+
+import (
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"strings"
+	"time"
+)
+
+func HasGroupSuffix(s string) bool {
+	return strings.HasSuffix(s, "@"+types.GroupServer)
+}
+
+func IsGroup(jid types.JID) bool {
+	return jid.Server == types.GroupServer
+}
+
+type GroupJoinRequestAction string
+
+const (
+	GroupJoinRequestCreated GroupJoinRequestAction = "created"
+	GroupJoinRequestRevoked GroupJoinRequestAction = "revoked"
+)
+
+// GroupJoinRequestEventData is issued when someone asks to join a group
+// with membership approval mode or cancels the request
+type GroupJoinRequestEventData struct {
+	JID          types.JID
+	Sender       *types.JID
+	Timestamp    time.Time
+	Action       GroupJoinRequestAction
+	Method       string // e.g. "invite_link"
+	Participants []types.JID
+}
+
+// GroupSettingsEventData is issued when group settings change,
+// only changed settings are set.
+// Join approval mode is not included - whatsmeow reports any change of it as enabled
+type GroupSettingsEventData struct {
+	JID       types.JID
+	Sender    *types.JID
+	Timestamp time.Time
+	Locked    *bool
+	Announce  *bool
+}
+
+// buildGroupEvents extracts join requests and settings changes from the group info event
+func buildGroupEvents(evt *events.GroupInfo) []interface{} {
+	var result []interface{}
+
+	for _, node := range evt.UnknownChanges {
+		var action GroupJoinRequestAction
+		switch node.Tag {
+		case "created_membership_requests":
+			action = GroupJoinRequestCreated
+		case "revoked_membership_requests":
+			action = GroupJoinRequestRevoked
+		default:
+			continue
+		}
+		var participants []types.JID
+		for _, child := range node.GetChildren() {
+			jid := child.AttrGetter().OptionalJID("jid")
+			if jid != nil {
+				participants = append(participants, *jid)
+			}
+		}
+		result = append(result, &GroupJoinRequestEventData{
+			JID:          evt.JID,
+			Sender:       evt.Sender,
+			Timestamp:    evt.Timestamp,
+			Action:       action,
+			Method:       node.AttrGetter().OptionalString("request_method"),
+			Participants: participants,
+		})
+	}
+
+	if evt.Locked != nil || evt.Announce != nil {
+		settings := &GroupSettingsEventData{
+			JID:       evt.JID,
+			Sender:    evt.Sender,
+			Timestamp: evt.Timestamp,
+		}
+		if evt.Locked != nil {
+			settings.Locked = &evt.Locked.IsLocked
+		}
+		if evt.Announce != nil {
+			settings.Announce = &evt.Announce.IsAnnounce
+		}
+		result = append(result, settings)
+	}
+	return result
+}
@@ -33,12 +33,29 @@ type ProxyConfig struct {
 	Url string
 }
 
+// MediaConfig configures automatic download of incoming media
+type MediaConfig struct {
+	AutoDownload bool
+	// Mimetypes to download, "image/*" matches all images. Empty - all
+	Mimetypes []string
+	// MaxSize in bytes, 0 - DefaultMediaMaxSize
+	MaxSize uint64
+	Storage MediaStorage
+}
+
 type SessionConfig struct {
 	Store StoreConfig
 	Log   LogConfig
 	Proxy ProxyConfig
+	Media MediaConfig
 }
 
+// SessionStartedEventData is issued when the session is started by the manager
+type SessionStartedEventData struct{}
+
+// SessionStoppedEventData is issued when the session is stopped
+type SessionStoppedEventData struct{}
+
 func init() {
 	// Firefox (Ubuntu)
 	store.DeviceProps.PlatformType = proto.DeviceProps_FIREFOX.Enum()
@@ -53,23 +70,24 @@ func NewSessionManager() *SessionManager {
 	}
 }
 
-func (sm *SessionManager) Start(name string, cfg SessionConfig) (*GoWS, error) {
+// Start starts the session, created is false if the session is already running
+func (sm *SessionManager) Start(name string, cfg SessionConfig) (gows *GoWS, created bool, err error) {
 	sm.sessionsLock.Lock()
 	defer sm.sessionsLock.Unlock()
-	gows, err := sm.unlockedStart(name, cfg)
+	if goWS, ok := sm.sessions[name]; ok {
+		return goWS, false, nil
+	}
+	gows, err = sm.unlockedStart(name, cfg)
 	if err != nil {
 		sm.log.Errorf("Error starting session '%s': %v", name, err)
 		sm.unlockedStop(name)
-		return nil, err
+		return nil, false, err
 	}
-	return gows, nil
+	return gows, true, nil
 }
 
 func (sm *SessionManager) unlockedStart(name string, cfg SessionConfig) (*GoWS, error) {
 	sm.log.Infof("Starting session '%s'...", name)
-	if goWS, ok := sm.sessions[name]; ok {
-		return goWS, nil
-	}
 
 	ctx := context.WithValue(context.Background(), "name", name)
 	log := gowsLog.Stdout("Session", cfg.Log.Level, false)
@@ -81,6 +99,7 @@ func (sm *SessionManager) unlockedStart(name string, cfg SessionConfig) (*GoWS,
 		return nil, err
 	}
 	sm.sessions[name] = gows
+	gows.media = &cfg.Media
 
 	err = gows.SetProxyAddress(cfg.Proxy.Url)
 	if err != nil {
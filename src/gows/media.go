@@ -1,11 +1,23 @@
 package gows
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/util/cbcutil"
+	"go.mau.fi/whatsmeow/util/hkdfutil"
+	"io"
 )
 
+// sidecarChunkSize - the streaming sidecar has a MAC for every chunk of the encrypted media
+const sidecarChunkSize = 64 * 1024
+
+var ErrSidecarMismatch = errors.New("encrypted content does not match the upload")
+
 func (gows *GoWS) UploadMedia(
 	ctx context.Context,
 	jid types.JID,
@@ -19,3 +31,49 @@ func (gows *GoWS) UploadMedia(
 	}
 	return resp, err
 }
+
+// UploadMediaReader uploads the content without loading it into memory.
+// The content is overwritten with the encrypted data for non-newsletter chats.
+func (gows *GoWS) UploadMediaReader(
+	ctx context.Context,
+	jid types.JID,
+	content io.ReadWriteSeeker,
+	mediaType whatsmeow.MediaType,
+) (resp whatsmeow.UploadResponse, err error) {
+	if IsNewsletter(jid) {
+		resp, err = gows.UploadNewsletterReader(ctx, content, mediaType)
+	} else {
+		resp, err = gows.UploadReader(ctx, content, content, mediaType)
+	}
+	return resp, err
+}
+
+// StreamingSidecar builds the sidecar that lets clients play the media while it's downloading.
+// The content is encrypted again with the upload media key, the same way whatsmeow does it.
+func StreamingSidecar(content []byte, upload whatsmeow.UploadResponse, mediaType whatsmeow.MediaType) ([]byte, error) {
+	expanded := hkdfutil.SHA256(upload.MediaKey, nil, []byte(mediaType), 112)
+	iv, cipherKey, macKey := expanded[:16], expanded[16:48], expanded[48:80]
+	ciphertext, err := cbcutil.Encrypt(cipherKey, iv, content)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	encrypted := append(ciphertext, mac.Sum(nil)[:10]...)
+	encryptedHash := sha256.Sum256(encrypted)
+	if !bytes.Equal(encryptedHash[:], upload.FileEncSHA256) {
+		return nil, ErrSidecarMismatch
+	}
+
+	// Every chunk is signed with the previous 16 bytes - the IV for decrypting it
+	data := append(append([]byte{}, iv...), encrypted...)
+	sidecar := make([]byte, 0, (len(encrypted)/sidecarChunkSize+1)*10)
+	for start := 0; start < len(encrypted); start += sidecarChunkSize {
+		end := min(start+sidecarChunkSize+16, len(data))
+		mac = hmac.New(sha256.New, macKey)
+		mac.Write(data[start:end])
+		sidecar = append(sidecar, mac.Sum(nil)[:10]...)
+	}
+	return sidecar, nil
+}
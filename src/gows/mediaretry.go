@@ -0,0 +1,193 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"io"
+	"sync"
+	"time"
+)
+
+// mediaRetryTimeout - how long to wait for the phone to re-upload the media
+const mediaRetryTimeout = 1 * time.Minute
+
+var ErrMediaRetryTimeout = errors.New("phone did not re-upload the media in time")
+var ErrMediaRetryFailed = errors.New("phone failed to re-upload the media")
+
+// mediaRetryStore keeps the pending media retry requests, so the response
+// can be passed to the waiting downloads - there can be many for the same message
+type mediaRetryStore struct {
+	lock    sync.Mutex
+	waiters map[types.MessageID][]chan *events.MediaRetry
+}
+
+func newMediaRetryStore() *mediaRetryStore {
+	return &mediaRetryStore{
+		waiters: map[types.MessageID][]chan *events.MediaRetry{},
+	}
+}
+
+func (ms *mediaRetryStore) wait(id types.MessageID) chan *events.MediaRetry {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	waiter := make(chan *events.MediaRetry, 1)
+	ms.waiters[id] = append(ms.waiters[id], waiter)
+	return waiter
+}
+
+func (ms *mediaRetryStore) done(id types.MessageID, waiter chan *events.MediaRetry) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	waiters := ms.waiters[id]
+	for i, w := range waiters {
+		if w == waiter {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(ms.waiters, id)
+	} else {
+		ms.waiters[id] = waiters
+	}
+}
+
+func (ms *mediaRetryStore) resolve(evt *events.MediaRetry) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	for _, waiter := range ms.waiters[evt.MessageID] {
+		select {
+		case waiter <- evt:
+		default:
+		}
+	}
+}
+
+// IsMediaExpired checks if the download failed because the media is no longer on the server
+func IsMediaExpired(err error) bool {
+	return errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410)
+}
+
+// getDownloadable gets the media part of the message, the same one DownloadAny downloads
+func getDownloadable(msg *waE2E.Message) whatsmeow.DownloadableMessage {
+	switch {
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage()
+	}
+	return nil
+}
+
+// setDirectPath replaces the media location with the re-uploaded one
+func setDirectPath(msg *waE2E.Message, directPath string) {
+	switch {
+	case msg.GetImageMessage() != nil:
+		msg.ImageMessage.URL = nil
+		msg.ImageMessage.DirectPath = &directPath
+	case msg.GetVideoMessage() != nil:
+		msg.VideoMessage.URL = nil
+		msg.VideoMessage.DirectPath = &directPath
+	case msg.GetAudioMessage() != nil:
+		msg.AudioMessage.URL = nil
+		msg.AudioMessage.DirectPath = &directPath
+	case msg.GetDocumentMessage() != nil:
+		msg.DocumentMessage.URL = nil
+		msg.DocumentMessage.DirectPath = &directPath
+	case msg.GetStickerMessage() != nil:
+		msg.StickerMessage.URL = nil
+		msg.StickerMessage.DirectPath = &directPath
+	}
+}
+
+// DownloadAnyWithRetry downloads the media and, if it has expired on the server,
+// asks the phone to re-upload it and downloads it again
+func (gows *GoWS) DownloadAnyWithRetry(ctx context.Context, msg *waE2E.Message, info *types.MessageInfo) ([]byte, error) {
+	content, err := gows.DownloadAny(msg)
+	if !IsMediaExpired(err) {
+		return content, err
+	}
+	err = gows.requestMediaRetry(ctx, msg, info)
+	if err != nil {
+		return nil, err
+	}
+	return gows.DownloadAny(msg)
+}
+
+// DownloadAnyToFile downloads the media into the file without keeping it in memory.
+// If info is set and the media has expired on the server, it asks the phone
+// to re-upload it and downloads it again
+func (gows *GoWS) DownloadAnyToFile(ctx context.Context, msg *waE2E.Message, info *types.MessageInfo, file whatsmeow.File) error {
+	downloadable := getDownloadable(msg)
+	if downloadable == nil {
+		return whatsmeow.ErrNothingDownloadableFound
+	}
+	err := gows.DownloadToFile(downloadable, file)
+	if info == nil || !IsMediaExpired(err) {
+		return err
+	}
+	err = gows.requestMediaRetry(ctx, msg, info)
+	if err != nil {
+		return err
+	}
+	// Drop whatever the failed attempt has written
+	err = file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return gows.DownloadToFile(getDownloadable(msg), file)
+}
+
+// requestMediaRetry asks the phone to re-upload the expired media
+// and points the message to the new location
+func (gows *GoWS) requestMediaRetry(ctx context.Context, msg *waE2E.Message, info *types.MessageInfo) error {
+	downloadable := getDownloadable(msg)
+	if downloadable == nil {
+		return whatsmeow.ErrNothingDownloadableFound
+	}
+	mediaKey := downloadable.GetMediaKey()
+
+	retries := gows.mediaRetries.wait(info.ID)
+	defer gows.mediaRetries.done(info.ID, retries)
+	gows.Log.Infof("Media for %s has expired, asking the phone to re-upload it", info.ID)
+	err := gows.SendMediaRetryReceipt(info, mediaKey)
+	if err != nil {
+		return fmt.Errorf("failed to send media retry receipt: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mediaRetryTimeout)
+	defer cancel()
+	var evt *events.MediaRetry
+	select {
+	case <-ctx.Done():
+		return ErrMediaRetryTimeout
+	case evt = <-retries:
+	}
+
+	retryData, err := whatsmeow.DecryptMediaRetryNotification(evt, mediaKey)
+	if err != nil {
+		return err
+	}
+	if retryData.GetResult() != waMmsRetry.MediaRetryNotification_SUCCESS {
+		return fmt.Errorf("%w: %s", ErrMediaRetryFailed, retryData.GetResult())
+	}
+	setDirectPath(msg, retryData.GetDirectPath())
+	return nil
+}
@@ -0,0 +1,229 @@
+package gows
+
+import (
+	"bytes"
+	"container/list"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"sync"
+	"time"
+)
+
+// pollStoreCapacity - how many polls are kept in memory
+const pollStoreCapacity = 1000
+
+// pollRetention - poll options are removed from the session store after
+const pollRetention = 90 * 24 * time.Hour
+
+// PollVoteEventData is issued instead of encrypted poll update messages
+type PollVoteEventData struct {
+	Info            types.MessageInfo
+	PollID          types.MessageID
+	Voter           types.JID
+	SelectedOptions []string
+	// Votes contains all known votes for the poll - option name to voters
+	Votes map[string][]types.JID
+	// Unresolved is set if the poll options are unknown,
+	// SelectedHashes are the only data about the vote then
+	Unresolved     bool
+	SelectedHashes [][]byte
+}
+
+var pollsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS gows_polls (
+		id         TEXT   PRIMARY KEY,
+		options    TEXT   NOT NULL,
+		created_at BIGINT NOT NULL
+	)`,
+}
+
+type pollEntry struct {
+	id      types.MessageID
+	options []string
+	// voter -> selected options
+	votes map[types.JID][]string
+}
+
+// pollStore keeps options and votes of the polls seen by the session,
+// so votes can be shown as option names.
+// Options are saved to the session store, recent polls are cached in memory
+type pollStore struct {
+	lock  sync.Mutex
+	db    *sql.DB
+	items map[types.MessageID]*list.Element
+	// front - the most recently used
+	order *list.List
+}
+
+func newPollStore(db *sql.DB) (*pollStore, error) {
+	for _, query := range pollsSchema {
+		_, err := db.Exec(query)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &pollStore{
+		db:    db,
+		items: map[types.MessageID]*list.Element{},
+		order: list.New(),
+	}, nil
+}
+
+// cache puts the poll to the front of the memory cache
+func (ps *pollStore) cache(entry *pollEntry) {
+	ps.items[entry.id] = ps.order.PushFront(entry)
+	for ps.order.Len() > pollStoreCapacity {
+		oldest := ps.order.Back()
+		ps.order.Remove(oldest)
+		delete(ps.items, oldest.Value.(*pollEntry).id)
+	}
+}
+
+// get finds the poll in memory or in the session store, nil if it's unknown
+func (ps *pollStore) get(pollID types.MessageID) (*pollEntry, error) {
+	if element, ok := ps.items[pollID]; ok {
+		ps.order.MoveToFront(element)
+		return element.Value.(*pollEntry), nil
+	}
+	var data string
+	err := ps.db.QueryRow("SELECT options FROM gows_polls WHERE id = $1", pollID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var options []string
+	err = json.Unmarshal([]byte(data), &options)
+	if err != nil {
+		return nil, err
+	}
+	entry := &pollEntry{id: pollID, options: options, votes: map[types.JID][]string{}}
+	ps.cache(entry)
+	return entry, nil
+}
+
+func getPollCreation(msg *waE2E.Message) *waE2E.PollCreationMessage {
+	switch {
+	case msg.GetPollCreationMessage() != nil:
+		return msg.GetPollCreationMessage()
+	case msg.GetPollCreationMessageV2() != nil:
+		return msg.GetPollCreationMessageV2()
+	case msg.GetPollCreationMessageV3() != nil:
+		return msg.GetPollCreationMessageV3()
+	}
+	return nil
+}
+
+// rememberPoll saves poll options if the message is a poll creation
+func (ps *pollStore) rememberPoll(evt *events.Message) error {
+	poll := getPollCreation(evt.Message)
+	if poll == nil {
+		return nil
+	}
+	options := make([]string, len(poll.GetOptions()))
+	for i, option := range poll.GetOptions() {
+		options[i] = option.GetOptionName()
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if element, ok := ps.items[evt.Info.ID]; ok {
+		ps.order.Remove(element)
+	}
+	ps.cache(&pollEntry{id: evt.Info.ID, options: options, votes: map[types.JID][]string{}})
+	_, err = ps.db.Exec(
+		"DELETE FROM gows_polls WHERE created_at < $1",
+		time.Now().Add(-pollRetention).Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = ps.db.Exec(
+		"INSERT INTO gows_polls (id, options, created_at) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING",
+		evt.Info.ID, string(data), time.Now().Unix(),
+	)
+	return err
+}
+
+// vote saves the vote and returns selected option names with all votes for the poll,
+// ok is false if the poll or the selected options are unknown
+func (ps *pollStore) vote(pollID types.MessageID, voter types.JID, hashes [][]byte) (selected []string, votes map[string][]types.JID, ok bool, err error) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	poll, err := ps.get(pollID)
+	if err != nil || poll == nil {
+		return nil, nil, false, err
+	}
+	optionHashes := whatsmeow.HashPollOptions(poll.options)
+	selected = make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		for i, optionHash := range optionHashes {
+			if bytes.Equal(hash, optionHash) {
+				selected = append(selected, poll.options[i])
+				break
+			}
+		}
+	}
+	if len(selected) != len(hashes) {
+		return nil, nil, false, nil
+	}
+
+	if len(selected) == 0 {
+		// Vote retracted
+		delete(poll.votes, voter)
+	} else {
+		poll.votes[voter] = selected
+	}
+
+	votes = make(map[string][]types.JID, len(poll.options))
+	for _, option := range poll.options {
+		votes[option] = []types.JID{}
+	}
+	for v, voterOptions := range poll.votes {
+		for _, option := range voterOptions {
+			votes[option] = append(votes[option], v)
+		}
+	}
+	return selected, votes, true, nil
+}
+
+// decryptPollVote decrypts the poll update message into the vote event
+func (gows *GoWS) decryptPollVote(evt *events.Message) (*PollVoteEventData, error) {
+	vote, err := gows.DecryptPollVote(evt)
+	if err != nil {
+		return nil, err
+	}
+	pollID := evt.Message.GetPollUpdateMessage().GetPollCreationMessageKey().GetID()
+	voter := evt.Info.Sender.ToNonAD()
+	selected, votes, ok, err := gows.polls.vote(pollID, voter, vote.GetSelectedOptions())
+	if err != nil {
+		gows.Log.Errorf("Failed to load poll %s: %v", pollID, err)
+	}
+	if !ok {
+		return &PollVoteEventData{
+			Info:           evt.Info,
+			PollID:         pollID,
+			Voter:          voter,
+			Unresolved:     true,
+			SelectedHashes: vote.GetSelectedOptions(),
+		}, nil
+	}
+	return &PollVoteEventData{
+		Info:            evt.Info,
+		PollID:          pollID,
+		Voter:           voter,
+		SelectedOptions: selected,
+		Votes:           votes,
+	}, nil
+}
@@ -1,17 +1,132 @@
 package media
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"github.com/u2takey/ffmpeg-go"
+	"math"
 )
 
+const (
+	waveformSamples = 64
+	// Sample rate for decoded audio, enough for waveform
+	pcmSampleRate = 8000
+	// Opus granule position is always in 48 kHz samples
+	opusSampleRate = 48000
+)
+
+// decodePCM decodes any audio supported by ffmpeg to mono 16-bit PCM
+func decodePCM(content []byte) ([]int16, error) {
+	raw, err := ffmpegConvert(
+		content,
+		ffmpeg_go.KwArgs{},
+		ffmpeg_go.KwArgs{"f": "s16le", "acodec": "pcm_s16le", "ac": 1, "ar": pcmSampleRate},
+	)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]int16, len(raw)/2)
+	err = binary.Read(bytes.NewReader(raw[:len(samples)*2]), binary.LittleEndian, samples)
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
 // Waveform generates a waveform from the audio content
 // 64 number from 0 to 100
 func Waveform(content []byte) ([]byte, error) {
-	// TODO: implement
-	return nil, fmt.Errorf("not implemented")
+	samples, err := decodePCM(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no audio samples")
+	}
+
+	// Average amplitude for each block
+	blockSize := int(math.Ceil(float64(len(samples)) / waveformSamples))
+	averages := make([]float64, waveformSamples)
+	var maximum float64
+	for i := range averages {
+		start := i * blockSize
+		end := min(start+blockSize, len(samples))
+		if start >= end {
+			break
+		}
+		var sum float64
+		for _, sample := range samples[start:end] {
+			sum += math.Abs(float64(sample))
+		}
+		averages[i] = sum / float64(end-start)
+		maximum = math.Max(maximum, averages[i])
+	}
+
+	// Normalize to 0-100
+	waveform := make([]byte, waveformSamples)
+	if maximum == 0 {
+		return waveform, nil
+	}
+	for i, average := range averages {
+		waveform[i] = byte(math.Round(average / maximum * 100))
+	}
+	return waveform, nil
 }
 
+// Duration returns the duration of the audio in seconds.
+// Other than OGG/Opus formats are probed, so the audio is not decoded again after the waveform
 func Duration(content []byte) (float32, error) {
-	// TODO: implement
-	return 0, fmt.Errorf("not implemented")
+	duration, err := oggOpusDuration(content)
+	if err == nil {
+		return duration, nil
+	}
+	probe, err := ffprobe(content)
+	if err != nil {
+		return 0, err
+	}
+	seconds := probe.duration()
+	if seconds == 0 {
+		return 0, fmt.Errorf("unknown audio duration")
+	}
+	return float32(seconds), nil
+}
+
+// oggOpusDuration gets the exact duration of OGG/Opus audio
+// from the granule position of the last page, no decoding required
+func oggOpusDuration(content []byte) (float32, error) {
+	if !bytes.HasPrefix(content, []byte("OggS")) {
+		return 0, fmt.Errorf("not an ogg file")
+	}
+	head := bytes.Index(content, []byte("OpusHead"))
+	if head == -1 || len(content) < head+12 {
+		return 0, fmt.Errorf("not an opus stream")
+	}
+	preSkip := binary.LittleEndian.Uint16(content[head+10 : head+12])
+
+	last := bytes.LastIndex(content, []byte("OggS"))
+	if len(content) < last+14 {
+		return 0, fmt.Errorf("invalid ogg page")
+	}
+	granule := int64(binary.LittleEndian.Uint64(content[last+6 : last+14]))
+	if granule < int64(preSkip) {
+		return 0, fmt.Errorf("invalid granule position")
+	}
+	return float32(granule-int64(preSkip)) / opusSampleRate, nil
+}
+
+// ConvertToOpus converts audio to OGG/Opus mono 48 kHz - the format WhatsApp uses for voice notes
+func ConvertToOpus(content []byte) ([]byte, error) {
+	return ffmpegConvert(
+		content,
+		ffmpeg_go.KwArgs{},
+		ffmpeg_go.KwArgs{
+			"f":      "ogg",
+			"vn":     "",
+			"acodec": "libopus",
+			"ac":     1,
+			"ar":     opusSampleRate,
+			"b:a":    "64k",
+		},
+	)
 }
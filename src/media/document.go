@@ -0,0 +1,199 @@
+package media
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"github.com/h2non/bimg"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const documentThumbnailWidth = 480
+
+// pdfObjectStreamMaxSize - inflated object streams are cut at this size
+const pdfObjectStreamMaxSize = 16 * 1024 * 1024
+
+var (
+	// Page objects, but not the page tree (/Type /Pages)
+	pdfPageRegexp = regexp.MustCompile(`/Type\s*/Page[^s]`)
+	// Document catalog reference in the trailer
+	pdfRootRegexp = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	// Page tree reference in the catalog
+	pdfPagesRegexp = regexp.MustCompile(`/Pages\s+(\d+)\s+(\d+)\s+R`)
+	// Page count in the page tree
+	pdfCountRegexp = regexp.MustCompile(`/Count\s+(\d+)`)
+	// Compressed object stream, the objects are in the stream data
+	pdfObjStmRegexp = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	// Offset of the first object in the object stream
+	pdfFirstRegexp = regexp.MustCompile(`/First\s+(\d+)`)
+)
+
+func IsPdf(content []byte) bool {
+	return bytes.HasPrefix(content, []byte("%PDF-"))
+}
+
+// PdfPageCount counts pages in the PDF without rendering it.
+// The count is taken from the root page tree (trailer /Root -> /Pages -> /Count),
+// page objects are counted if there's no page tree.
+// Compressed object streams are inflated first, so the objects in them are found too.
+func PdfPageCount(content []byte) (uint32, error) {
+	if !IsPdf(content) {
+		return 0, fmt.Errorf("not a pdf document")
+	}
+	content = pdfExpandObjectStreams(content)
+	if pages, ok := pdfRootPageCount(content); ok {
+		return pages, nil
+	}
+	pages := len(pdfPageRegexp.FindAll(content, -1))
+	if pages == 0 {
+		return 0, fmt.Errorf("no pages found")
+	}
+	return uint32(pages), nil
+}
+
+// pdfRootPageCount gets /Count of the root page tree
+func pdfRootPageCount(content []byte) (uint32, bool) {
+	// The last trailer is the latest incremental update
+	roots := pdfRootRegexp.FindAllSubmatch(content, -1)
+	if len(roots) == 0 {
+		return 0, false
+	}
+	root := roots[len(roots)-1]
+	catalog := pdfObject(content, root[1], root[2])
+	pages := pdfPagesRegexp.FindSubmatch(catalog)
+	if pages == nil {
+		return 0, false
+	}
+	tree := pdfObject(content, pages[1], pages[2])
+	count := pdfCountRegexp.FindSubmatch(tree)
+	if count == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(string(count[1]), 10, 32)
+	if err != nil || value == 0 {
+		return 0, false
+	}
+	return uint32(value), true
+}
+
+// pdfExpandObjectStreams appends the objects from compressed object streams (/ObjStm)
+// as plain "N 0 obj ... endobj", so they are found the same way as uncompressed ones
+func pdfExpandObjectStreams(content []byte) []byte {
+	locations := pdfObjStmRegexp.FindAllIndex(content, -1)
+	if len(locations) == 0 {
+		return content
+	}
+	expanded := bytes.Clone(content)
+	for _, location := range locations {
+		expanded = append(expanded, pdfObjectStream(content, location[1])...)
+	}
+	return expanded
+}
+
+// pdfObjectStream inflates the object stream which dictionary has the offset
+// and returns its objects, nil if the stream can't be read
+func pdfObjectStream(content []byte, offset int) []byte {
+	dictStart := bytes.LastIndex(content[:offset], []byte("obj"))
+	dictEnd := bytes.Index(content[offset:], []byte("stream"))
+	if dictStart < 0 || dictEnd < 0 {
+		return nil
+	}
+	dict := content[dictStart : offset+dictEnd]
+	if !bytes.Contains(dict, []byte("/FlateDecode")) {
+		return nil
+	}
+	firstMatch := pdfFirstRegexp.FindSubmatch(dict)
+	if firstMatch == nil {
+		return nil
+	}
+	first, err := strconv.Atoi(string(firstMatch[1]))
+	if err != nil {
+		return nil
+	}
+
+	// The stream keyword is followed by the end of line
+	data := bytes.TrimLeft(content[offset+dictEnd+len("stream"):], "\r\n")
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	inflated, err := io.ReadAll(io.LimitReader(reader, pdfObjectStreamMaxSize))
+	if err != nil && len(inflated) == 0 {
+		return nil
+	}
+	if first > len(inflated) {
+		return nil
+	}
+
+	// The header is pairs of the object number and its offset from /First
+	header := strings.Fields(string(inflated[:first]))
+	body := inflated[first:]
+	var objects bytes.Buffer
+	for i := 0; i+1 < len(header); i += 2 {
+		start, err := strconv.Atoi(header[i+1])
+		if err != nil {
+			break
+		}
+		end := len(body)
+		if i+3 < len(header) {
+			end, err = strconv.Atoi(header[i+3])
+			if err != nil {
+				break
+			}
+		}
+		if start < 0 || start > end || end > len(body) {
+			break
+		}
+		// Objects in the streams always have generation 0
+		fmt.Fprintf(&objects, "\n%s 0 obj\n%s\nendobj\n", header[i], body[start:end])
+	}
+	return objects.Bytes()
+}
+
+// pdfObject gets the body of the uncompressed object, nil if it's not found.
+// The last definition wins, the same as for incremental updates
+func pdfObject(content []byte, num []byte, gen []byte) []byte {
+	header := regexp.MustCompile(`(?:^|\s)` + string(num) + `\s+` + string(gen) + `\s+obj\b`)
+	matches := header.FindAllIndex(content, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	start := matches[len(matches)-1][1]
+	end := bytes.Index(content[start:], []byte("endobj"))
+	if end < 0 {
+		return nil
+	}
+	return content[start : start+end]
+}
+
+type DocumentPreview struct {
+	Thumbnail []byte
+	Width     uint32
+	Height    uint32
+}
+
+// DocumentThumbnail renders the first page of the PDF (or the image) as JPEG
+func DocumentThumbnail(content []byte) (*DocumentPreview, error) {
+	img := bimg.NewImage(content)
+	options := bimg.Options{
+		Width: documentThumbnailWidth,
+		Type:  bimg.JPEG,
+	}
+	thumbnail, err := img.Process(options)
+	if err != nil {
+		return nil, err
+	}
+	size, err := bimg.NewImage(thumbnail).Size()
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentPreview{
+		Thumbnail: thumbnail,
+		Width:     uint32(size.Width),
+		Height:    uint32(size.Height),
+	}, nil
+}
@@ -0,0 +1,127 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/u2takey/ffmpeg-go"
+	"os"
+	"strconv"
+)
+
+// writeTemp writes the content to a temporary file, the caller must remove it
+func writeTemp(content []byte) (string, error) {
+	file, err := os.CreateTemp("", "gows-input-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(content)
+	_ = file.Close()
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// ffmpegConvert runs ffmpeg over the content and returns the output.
+// Temporary files are used instead of pipes, so formats with the index
+// at the end (like mp4 or m4a) can be read and written too.
+func ffmpegConvert(content []byte, inputArgs ffmpeg_go.KwArgs, outputArgs ffmpeg_go.KwArgs) ([]byte, error) {
+	input, err := writeTemp(content)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(input)
+
+	output, err := os.CreateTemp("", "gows-output-*")
+	if err != nil {
+		return nil, err
+	}
+	_ = output.Close()
+	defer os.Remove(output.Name())
+
+	err = ffmpeg_go.Input(input, inputArgs).
+		Output(output.Name(), outputArgs).
+		WithErrorOutput(os.Stderr).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(output.Name())
+}
+
+type probeStream struct {
+	CodecType string `json:"codec_type"`
+	CodecName string `json:"codec_name"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Tags      struct {
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+	SideDataList []struct {
+		Rotation float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// rotation gets the display rotation in degrees, 0-359.
+// Older muxers write the rotate tag, newer ones - display matrix side data
+func (s *probeStream) rotation() int {
+	rotation, err := strconv.Atoi(s.Tags.Rotate)
+	if err != nil {
+		rotation = 0
+		for _, data := range s.SideDataList {
+			if data.Rotation != 0 {
+				rotation = int(data.Rotation)
+				break
+			}
+		}
+	}
+	return (rotation%360 + 360) % 360
+}
+
+type probeResult struct {
+	Streams []probeStream `json:"streams"`
+	Format  struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// ffprobe returns streams and format information about the content
+func ffprobe(content []byte) (*probeResult, error) {
+	input, err := writeTemp(content)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(input)
+
+	data, err := ffmpeg_go.Probe(input)
+	if err != nil {
+		return nil, err
+	}
+	var result probeResult
+	err = json.Unmarshal([]byte(data), &result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+	return &result, nil
+}
+
+// duration parses the format duration in seconds
+func (p *probeResult) duration() float64 {
+	duration, err := strconv.ParseFloat(p.Format.Duration, 64)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// stream returns the first stream of the type - video, audio
+func (p *probeResult) stream(codecType string) *probeStream {
+	for i := range p.Streams {
+		if p.Streams[i].CodecType == codecType {
+			return &p.Streams[i]
+		}
+	}
+	return nil
+}
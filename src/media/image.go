@@ -1,6 +1,7 @@
 package media
 
 import (
+	"fmt"
 	"github.com/h2non/bimg"
 )
 
@@ -18,3 +19,119 @@ func ImageThumbnail(image []byte) ([]byte, error) {
 	}
 	return thumbnail, nil
 }
+
+type Image struct {
+	Content  []byte
+	Mimetype string
+	Width    uint32
+	Height   uint32
+}
+
+// Lower JPEG quality steps to fit the image into the size limit
+var recompressQualities = []int{85, 75, 65, 55, 45}
+
+// recompressMinSide - the image is not downsized below this to fit into the size limit
+const recompressMinSide = 64
+
+// JPEG has no alpha channel, transparent pixels become white
+var jpegBackground = bimg.Color{R: 255, G: 255, B: 255}
+
+// PrepareImage rotates the image according to EXIF orientation and
+// optionally downsizes it to maxSide pixels and recompresses it as JPEG to fit into maxBytes.
+// Zero limits keep the image as is.
+// If the lowest quality doesn't fit into maxBytes, the image is downsized further.
+func PrepareImage(content []byte, mimetype string, maxSide uint32, maxBytes uint64) (*Image, error) {
+	metadata, err := bimg.NewImage(content).Metadata()
+	if err != nil {
+		return nil, err
+	}
+	width, height := metadata.Size.Width, metadata.Size.Height
+	// 5-8 orientations are rotated by 90 degrees
+	if metadata.Orientation >= 5 {
+		width, height = height, width
+	}
+
+	rotate := metadata.Orientation > 1
+	resize := maxSide != 0 && uint32(max(width, height)) > maxSide
+	recompress := maxBytes != 0 && uint64(len(content)) > maxBytes
+	if !rotate && !resize && !recompress {
+		return &Image{
+			Content:  content,
+			Mimetype: mimetype,
+			Width:    uint32(width),
+			Height:   uint32(height),
+		}, nil
+	}
+
+	// Auto rotation is applied on any processing,
+	// EXIF is stripped so the orientation is not applied again by the clients
+	options := bimg.Options{StripMetadata: true}
+	if resize {
+		// Fits into the square keeping the aspect ratio
+		options.Width = int(maxSide)
+		options.Height = int(maxSide)
+	}
+	processed, err := bimg.NewImage(content).Process(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxBytes != 0 && uint64(len(processed)) > maxBytes {
+		mimetype = "image/jpeg"
+		side := max(width, height)
+		if resize {
+			side = int(maxSide)
+		}
+		processed, err = recompressImage(content, side, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size, err := bimg.NewImage(processed).Size()
+	if err != nil {
+		return nil, err
+	}
+	return &Image{
+		Content:  processed,
+		Mimetype: mimetype,
+		Width:    uint32(size.Width),
+		Height:   uint32(size.Height),
+	}, nil
+}
+
+// recompressImage encodes the image as JPEG with lower qualities to fit into maxBytes,
+// then downsizes it with the lowest quality until it fits
+func recompressImage(content []byte, side int, maxBytes uint64) ([]byte, error) {
+	encode := func(side int, quality int) ([]byte, error) {
+		return bimg.NewImage(content).Process(bimg.Options{
+			Width:         side,
+			Height:        side,
+			Type:          bimg.JPEG,
+			Quality:       quality,
+			Background:    jpegBackground,
+			StripMetadata: true,
+		})
+	}
+
+	for _, quality := range recompressQualities {
+		processed, err := encode(side, quality)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(processed)) <= maxBytes {
+			return processed, nil
+		}
+	}
+	lowest := recompressQualities[len(recompressQualities)-1]
+	for side = side * 3 / 4; side >= recompressMinSide; side = side * 3 / 4 {
+		processed, err := encode(side, lowest)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(processed)) <= maxBytes {
+			return processed, nil
+		}
+	}
+	return nil, fmt.Errorf("image doesn't fit into %d bytes", maxBytes)
+}
@@ -0,0 +1,104 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/h2non/bimg"
+	"image"
+	"image/draw"
+	"image/png"
+)
+
+const stickerSize = 512
+
+type Sticker struct {
+	Content  []byte
+	Width    uint32
+	Height   uint32
+	Animated bool
+}
+
+// isAnimatedWebp checks the animation flag in the extended (VP8X) WebP header
+func isAnimatedWebp(content []byte) bool {
+	if len(content) < 30 {
+		return false
+	}
+	if !bytes.Equal(content[0:4], []byte("RIFF")) || !bytes.Equal(content[8:12], []byte("WEBP")) {
+		return false
+	}
+	if !bytes.Equal(content[12:16], []byte("VP8X")) {
+		return false
+	}
+	return content[20]&0x02 != 0
+}
+
+// webpCanvasSize reads the canvas size from the extended (VP8X) WebP header
+func webpCanvasSize(content []byte) (uint32, uint32) {
+	width := uint32(content[24]) | uint32(content[25])<<8 | uint32(content[26])<<16
+	height := uint32(content[27]) | uint32(content[28])<<8 | uint32(content[29])<<16
+	// Stored as size - 1
+	return width + 1, height + 1
+}
+
+// StickerWebp converts PNG, JPEG or WebP image to 512x512 WebP sticker with transparent borders.
+// Animated WebP is kept as is, because the conversion keeps the first frame only,
+// so it must be 512x512 already.
+func StickerWebp(content []byte) (*Sticker, error) {
+	if isAnimatedWebp(content) {
+		width, height := webpCanvasSize(content)
+		if width != stickerSize || height != stickerSize {
+			return nil, fmt.Errorf("animated sticker must be %dx%d, got %dx%d", stickerSize, stickerSize, width, height)
+		}
+		return &Sticker{
+			Content:  content,
+			Width:    width,
+			Height:   height,
+			Animated: true,
+		}, nil
+	}
+
+	// Fit into the square keeping the aspect ratio
+	fitted, err := bimg.NewImage(content).Process(bimg.Options{
+		Width:  stickerSize,
+		Height: stickerSize,
+		Type:   bimg.PNG,
+	})
+	if err != nil {
+		return nil, err
+	}
+	canvas, err := transparentSquare(fitted, stickerSize)
+	if err != nil {
+		return nil, err
+	}
+	sticker, err := bimg.NewImage(canvas).Process(bimg.Options{Type: bimg.WEBP})
+	if err != nil {
+		return nil, err
+	}
+	return &Sticker{
+		Content:  sticker,
+		Width:    stickerSize,
+		Height:   stickerSize,
+		Animated: false,
+	}, nil
+}
+
+// transparentSquare centers the PNG image on the transparent square canvas.
+// The canvas has the alpha channel even for images without it (JPEG),
+// so the borders are not filled with black
+func transparentSquare(content []byte, size int) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	canvas := image.NewNRGBA(image.Rect(0, 0, size, size))
+	offset := image.Pt((size-bounds.Dx())/2, (size-bounds.Dy())/2)
+	draw.Draw(canvas, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Src)
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, canvas)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
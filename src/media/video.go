@@ -53,3 +53,50 @@ func VideoThumbnail(content []byte, frameNum int, size struct{ Width int }) ([]b
 	}
 	return buf.Bytes(), nil
 }
+
+type VideoInfo struct {
+	Duration float64
+	Width    uint32
+	Height   uint32
+}
+
+// VideoMetadata gets duration and dimensions of the video as it's displayed
+func VideoMetadata(content []byte) (*VideoInfo, error) {
+	probe, err := ffprobe(content)
+	if err != nil {
+		return nil, err
+	}
+	video := probe.stream("video")
+	if video == nil {
+		return nil, fmt.Errorf("no video stream found")
+	}
+	width, height := uint32(video.Width), uint32(video.Height)
+	if rotation := video.rotation(); rotation == 90 || rotation == 270 {
+		width, height = height, width
+	}
+	return &VideoInfo{
+		Duration: probe.duration(),
+		Width:    width,
+		Height:   height,
+	}, nil
+}
+
+// ConvertToMp4 converts video to H.264/AAC MP4 playable on all WhatsApp clients
+func ConvertToMp4(content []byte) ([]byte, error) {
+	return ffmpegConvert(
+		content,
+		ffmpeg_go.KwArgs{},
+		ffmpeg_go.KwArgs{
+			"f":         "mp4",
+			"vcodec":    "libx264",
+			"pix_fmt":   "yuv420p",
+			"profile:v": "baseline",
+			"level":     "3.1",
+			// H.264 requires even dimensions
+			"vf":       "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+			"acodec":   "aac",
+			"b:a":      "128k",
+			"movflags": "+faststart",
+		},
+	)
+}
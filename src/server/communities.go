@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	__ "github.com/devlikeapro/gows/proto"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func (s *Server) CreateCommunity(ctx context.Context, req *__.CreateCommunityRequest) (*__.Group, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	participants, err := parseJIDs(req.GetParticipants())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.CreateGroup(whatsmeow.ReqCreateGroup{
+		Name:         req.GetName(),
+		Participants: participants,
+		GroupParent:  types.GroupParent{IsParent: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toGroup(resp), nil
+}
+
+func (s *Server) LinkGroup(ctx context.Context, req *__.LinkGroupRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	parent, err := parseGroupJID(req.GetParent())
+	if err != nil {
+		return nil, err
+	}
+	child, err := parseGroupJID(req.GetChild())
+	if err != nil {
+		return nil, err
+	}
+	err = cli.LinkGroup(parent, child)
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
+
+func (s *Server) UnlinkGroup(ctx context.Context, req *__.LinkGroupRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	parent, err := parseGroupJID(req.GetParent())
+	if err != nil {
+		return nil, err
+	}
+	child, err := parseGroupJID(req.GetChild())
+	if err != nil {
+		return nil, err
+	}
+	err = cli.UnlinkGroup(parent, child)
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
+
+func (s *Server) GetSubGroups(ctx context.Context, req *__.CommunityRequest) (*__.SubGroupList, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.GetSubGroups(jid)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*__.SubGroup, len(resp))
+	for i, g := range resp {
+		list[i] = &__.SubGroup{
+			Jid:       g.JID.String(),
+			Name:      g.Name,
+			IsDefault: g.IsDefaultSubGroup,
+		}
+	}
+	return &__.SubGroupList{Groups: list}, nil
+}
+
+func (s *Server) GetCommunityParticipants(ctx context.Context, req *__.CommunityRequest) (*__.CommunityParticipantList, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.GetLinkedGroupsParticipants(jid)
+	if err != nil {
+		return nil, err
+	}
+	jids := make([]string, len(resp))
+	for i, j := range resp {
+		jids[i] = j.String()
+	}
+	return &__.CommunityParticipantList{Jids: jids}, nil
+}
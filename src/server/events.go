@@ -1,11 +1,13 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/devlikeapro/gows/proto"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"reflect"
 	"strings"
 )
@@ -27,29 +29,73 @@ func (s *Server) safeMarshal(v interface{}) (result string) {
 	return result
 }
 
-func (s *Server) StreamEvents(req *__.Session, stream grpc.ServerStreamingServer[__.EventJson]) error {
+// issuedEvent is the event with its sequence number in the session event journal
+type issuedEvent struct {
+	// 0 if the journal is not enabled
+	Sequence uint64
+	Session  string
+	Type     string
+	Source   eventSource
+	Event    interface{}
+}
+
+func (s *Server) StreamEvents(req *__.StreamEventsRequest, stream grpc.ServerStreamingServer[__.EventJson]) error {
 	name := req.GetId()
+	filter, err := newEventFilter(req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	streamId := uuid.New()
-	listener := s.addListener(name, streamId)
+	// Listen before the replay, so no events are lost in between
+	listener := newEventListener(req.GetQueueSize(), req.GetOverflow(), filter, s.lookupMetrics(name))
+	s.addListener(name, streamId, listener)
 	defer s.removeListener(name, streamId)
+
+	// Send the events missed since the cursor first
+	last := req.GetAfterSequence()
+	if req.GetResume() {
+		journal := s.getJournal(name)
+		if journal == nil {
+			return status.Error(codes.FailedPrecondition, ErrJournalDisabled.Error())
+		}
+		err := journal.replay(last, func(entry journalEntry) error {
+			last = entry.Sequence
+			if !filter.match(entry.Event, entry.Source) {
+				return nil
+			}
+			return stream.Send(&__.EventJson{
+				Session:  name,
+				Event:    entry.Event,
+				Data:     entry.Data,
+				Sequence: entry.Sequence,
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	for {
 		select {
 		case <-stream.Context().Done():
 			return stream.Context().Err()
-		case event := <-listener:
-			// Remove * at the start if it's *
-			eventType := reflect.TypeOf(event).String()
-			eventType = strings.TrimPrefix(eventType, "*")
-
-			jsonString := s.safeMarshal(event)
+		case <-listener.done:
+			return listener.closeError()
+		case event := <-listener.queue:
+			// Already sent from the journal
+			if event.Sequence != 0 && event.Sequence <= last {
+				continue
+			}
+			jsonString := s.safeMarshal(event.Event)
 			if jsonString == "" {
 				continue
 			}
 
 			data := __.EventJson{
-				Session: name,
-				Event:   eventType,
-				Data:    jsonString,
+				Session:  name,
+				Event:    event.Type,
+				Data:     jsonString,
+				Sequence: event.Sequence,
 			}
 			err := stream.Send(&data)
 			if err != nil {
@@ -59,56 +105,132 @@ func (s *Server) StreamEvents(req *__.Session, stream grpc.ServerStreamingServer
 	}
 }
 
-func (s *Server) IssueEvent(session string, event interface{}) {
-	listeners := s.getListeners(session)
-	for _, listener := range listeners {
-		go func() {
-			defer func() {
-				if err := recover(); err != nil {
-					// Print log error and ignore
-					fmt.Print("Error when sending event to listener: ", err)
-				}
-			}()
-			listener <- event
-		}()
+// AckEvents removes delivered events from the session event journal
+func (s *Server) AckEvents(ctx context.Context, req *__.AckEventsRequest) (*__.Empty, error) {
+	journal := s.getJournal(req.GetSession().GetId())
+	if journal == nil {
+		return nil, status.Error(codes.FailedPrecondition, ErrJournalDisabled.Error())
+	}
+	err := journal.ack(req.GetSequence())
+	if err != nil {
+		return nil, err
 	}
+	return &__.Empty{}, nil
+}
+
+// getEventType gets the event name from its type - events.Message, gows.ConnectedEventData, etc.
+func getEventType(event interface{}) string {
+	// Remove * at the start if it's *
+	eventType := reflect.TypeOf(event).String()
+	return strings.TrimPrefix(eventType, "*")
 }
 
-func (s *Server) addListener(session string, id uuid.UUID) chan interface{} {
-	s.listenersLock.Lock()
-	defer s.listenersLock.Unlock()
+func (s *Server) IssueEvent(session string, event interface{}) {
+	issued := &issuedEvent{
+		Session: session,
+		Type:    getEventType(event),
+		Source:  getEventSource(event),
+		Event:   event,
+	}
+	journal := s.getJournal(session)
+	webhooks := s.getWebhooks(session)
+	var data string
+	var journalFailed bool
+	if journal != nil || webhooks != nil {
+		data = s.safeMarshal(event)
+	}
+	if journal != nil && data != "" {
+		seq, err := journal.append(issued.Type, issued.Source, data)
+		if err != nil {
+			s.log.Errorf("Failed to save event to journal: %v", err)
+			s.lookupMetrics(session).journalFailures.Add(1)
+			journalFailed = true
+		}
+		issued.Sequence = seq
+	}
+	if webhooks != nil && data != "" {
+		webhooks.send(&__.EventJson{
+			Session:  session,
+			Event:    issued.Type,
+			Data:     data,
+			Sequence: issued.Sequence,
+		})
+	}
 
-	listener := make(chan interface{}, 10)
-	sessionListeners, ok := s.listeners[session]
-	if !ok {
-		sessionListeners = map[uuid.UUID]chan interface{}{}
-		s.listeners[session] = sessionListeners
-	}
-	sessionListeners[id] = listener
-	return listener
+	s.lookupMetrics(session).issued.Add(1)
+	// Events of a session are issued one by one, so listeners get them in order
+	for _, listener := range s.getListeners(session) {
+		if journalFailed {
+			// Session listeners resume from the journal, so they must reconnect instead of missing the event
+			listener.closeWith(status.Error(codes.Unavailable, ErrJournalWriteFailed.Error()))
+			continue
+		}
+		listener.send(issued)
+	}
+	for _, listener := range s.getAllListeners() {
+		listener.send(issued)
+	}
 }
 
-func (s *Server) removeListener(session string, id uuid.UUID) {
-	s.listenersLock.Lock()
-	defer s.listenersLock.Unlock()
-	listener, ok := s.listeners[session][id]
-	if !ok {
-		return
-	}
-	delete(s.listeners[session], id)
-	// if it's the last listener, remove the session
-	if len(s.listeners[session]) == 0 {
-		delete(s.listeners, session)
-	}
-	close(listener)
+// issueLifecycleEvent issues the session started/stopped event to StreamAllEvents listeners
+// and the session webhooks
+func (s *Server) issueLifecycleEvent(session string, event interface{}) {
+	issued := &issuedEvent{
+		Session: session,
+		Type:    getEventType(event),
+		Event:   event,
+	}
+	if webhooks := s.getWebhooks(session); webhooks != nil {
+		webhooks.send(&__.EventJson{
+			Session: session,
+			Event:   issued.Type,
+			Data:    s.safeMarshal(event),
+		})
+	}
+	s.getMetrics("").issued.Add(1)
+	for _, listener := range s.getAllListeners() {
+		listener.send(issued)
+	}
 }
 
-func (s *Server) getListeners(session string) []chan interface{} {
-	s.listenersLock.RLock()
-	defer s.listenersLock.RUnlock()
-	listeners := make([]chan interface{}, 0, len(s.listeners))
-	for _, listener := range s.listeners[session] {
-		listeners = append(listeners, listener)
-	}
-	return listeners
+// StreamAllEvents streams events of all sessions, including session started/stopped events
+func (s *Server) StreamAllEvents(req *__.StreamAllEventsRequest, stream grpc.ServerStreamingServer[__.EventJson]) error {
+	// A slow listener would hold the events of every session
+	if req.GetOverflow() == __.OverflowPolicy_BLOCK {
+		return status.Error(codes.InvalidArgument, "BLOCK overflow policy is not supported for all events")
+	}
+	filter, err := newEventFilter(req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	streamId := uuid.New()
+	listener := newEventListener(req.GetQueueSize(), req.GetOverflow(), filter, s.getMetrics(""))
+	if len(req.GetSessions()) != 0 {
+		listener.sessions = toSet(req.GetSessions())
+	}
+	s.addAllListener(streamId, listener)
+	defer s.removeAllListener(streamId)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-listener.done:
+			return listener.closeError()
+		case event := <-listener.queue:
+			jsonString := s.safeMarshal(event.Event)
+			if jsonString == "" {
+				continue
+			}
+			err = stream.Send(&__.EventJson{
+				Session:  event.Session,
+				Event:    event.Type,
+				Data:     jsonString,
+				Sequence: event.Sequence,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
 }
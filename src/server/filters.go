@@ -0,0 +1,131 @@
+package server
+
+import (
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// eventSource is the chat the event is related to
+type eventSource struct {
+	// empty if the event is not related to a chat
+	Chat string
+	// nil if the event has no sender
+	FromMe *bool
+}
+
+func newEventSource(chat types.JID, fromMe *bool) eventSource {
+	return eventSource{Chat: chat.ToNonAD().String(), FromMe: fromMe}
+}
+
+func getEventSource(event interface{}) eventSource {
+	switch evt := event.(type) {
+	case *events.Message:
+		return newEventSource(evt.Info.Chat, &evt.Info.IsFromMe)
+	case *gows.MediaDownloadedEventData:
+		return newEventSource(evt.Info.Chat, &evt.Info.IsFromMe)
+	case *gows.PollVoteEventData:
+		return newEventSource(evt.Info.Chat, &evt.Info.IsFromMe)
+	case *events.Receipt:
+		return newEventSource(evt.Chat, &evt.IsFromMe)
+	case *events.ChatPresence:
+		return newEventSource(evt.Chat, &evt.IsFromMe)
+	case *events.Presence:
+		return newEventSource(evt.From, nil)
+	case *events.GroupInfo:
+		return newEventSource(evt.JID, nil)
+	case *gows.GroupJoinRequestEventData:
+		return newEventSource(evt.JID, nil)
+	case *gows.GroupSettingsEventData:
+		return newEventSource(evt.JID, nil)
+	case *events.Picture:
+		return newEventSource(evt.JID, nil)
+	}
+	return eventSource{}
+}
+
+// eventFilter decides which events the listener gets
+type eventFilter struct {
+	includeEvents map[string]bool
+	excludeEvents map[string]bool
+	includeChats  map[string]bool
+	excludeChats  map[string]bool
+	fromMe        *bool
+}
+
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func toChatSet(values []string) (map[string]bool, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		jid, err := types.ParseJID(value)
+		if err != nil {
+			return nil, err
+		}
+		set[jid.ToNonAD().String()] = true
+	}
+	return set, nil
+}
+
+// newEventFilter builds the filter, nil filter passes all events
+func newEventFilter(filter *__.EventFilter) (*eventFilter, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	includeChats, err := toChatSet(filter.IncludeChats)
+	if err != nil {
+		return nil, err
+	}
+	excludeChats, err := toChatSet(filter.ExcludeChats)
+	if err != nil {
+		return nil, err
+	}
+	result := &eventFilter{
+		includeEvents: toSet(filter.IncludeEvents),
+		excludeEvents: toSet(filter.ExcludeEvents),
+		includeChats:  includeChats,
+		excludeChats:  excludeChats,
+	}
+	if filter.FromMe != nil {
+		result.fromMe = &filter.FromMe.Value
+	}
+	return result, nil
+}
+
+func (f *eventFilter) match(eventType string, source eventSource) bool {
+	if f == nil {
+		return true
+	}
+	if f.includeEvents != nil && !f.includeEvents[eventType] {
+		return false
+	}
+	if f.excludeEvents[eventType] {
+		return false
+	}
+	// Chat filters apply to chat related events only
+	if source.Chat != "" {
+		if f.includeChats != nil && !f.includeChats[source.Chat] {
+			return false
+		}
+		if f.excludeChats[source.Chat] {
+			return false
+		}
+	}
+	if f.fromMe != nil && source.FromMe != nil && *f.fromMe != *source.FromMe {
+		return false
+	}
+	return true
+}
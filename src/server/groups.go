@@ -0,0 +1,466 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/devlikeapro/gows/gows"
+	__ "github.com/devlikeapro/gows/proto"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func toParticipant(p types.GroupParticipant) *__.GroupParticipant {
+	var lid string
+	if !p.LID.IsEmpty() {
+		lid = p.LID.String()
+	}
+	return &__.GroupParticipant{
+		Jid:          p.JID.String(),
+		Lid:          lid,
+		IsAdmin:      p.IsAdmin,
+		IsSuperAdmin: p.IsSuperAdmin,
+		Error:        int32(p.Error),
+	}
+}
+
+func toParticipants(participants []types.GroupParticipant) []*__.GroupParticipant {
+	list := make([]*__.GroupParticipant, len(participants))
+	for i, p := range participants {
+		list[i] = toParticipant(p)
+	}
+	return list
+}
+
+func toGroup(g *types.GroupInfo) *__.Group {
+	var owner string
+	if !g.OwnerJID.IsEmpty() {
+		owner = g.OwnerJID.String()
+	}
+	var parent string
+	if !g.LinkedParentJID.IsEmpty() {
+		parent = g.LinkedParentJID.String()
+	}
+	return &__.Group{
+		Id:           g.JID.String(),
+		Name:         g.Name,
+		Topic:        g.Topic,
+		Owner:        owner,
+		Created:      g.GroupCreated.Unix(),
+		Locked:       g.IsLocked,
+		Announce:     g.IsAnnounce,
+		Ephemeral:    g.DisappearingTimer,
+		Participants: toParticipants(g.Participants),
+
+		JoinApprovalRequired: g.IsJoinApprovalRequired,
+		IsCommunity:          g.IsParent,
+		Parent:               parent,
+	}
+}
+
+// parseJIDs parses a list of jids, failing on the first invalid one
+func parseJIDs(values []string) ([]types.JID, error) {
+	jids := make([]types.JID, len(values))
+	for i, value := range values {
+		jid, err := types.ParseJID(value)
+		if err != nil {
+			return nil, err
+		}
+		jids[i] = jid
+	}
+	return jids, nil
+}
+
+func parseGroupJID(value string) (types.JID, error) {
+	jid, err := types.ParseJID(value)
+	if err != nil {
+		return types.EmptyJID, err
+	}
+	if !gows.IsGroup(jid) {
+		return types.EmptyJID, errors.New("invalid jid, not a group")
+	}
+	return jid, nil
+}
+
+func (s *Server) CreateGroup(ctx context.Context, req *__.CreateGroupRequest) (*__.Group, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	participants, err := parseJIDs(req.GetParticipants())
+	if err != nil {
+		return nil, err
+	}
+	params := whatsmeow.ReqCreateGroup{
+		Name:         req.GetName(),
+		Participants: participants,
+	}
+	if req.GetParent() != "" {
+		params.LinkedParentJID, err = parseGroupJID(req.GetParent())
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp, err := cli.CreateGroup(params)
+	if err != nil {
+		return nil, err
+	}
+	return toGroup(resp), nil
+}
+
+func (s *Server) GetJoinedGroups(ctx context.Context, req *__.JoinedGroupsRequest) (*__.GroupList, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.GetJoinedGroups()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*__.Group, len(resp))
+	for i, g := range resp {
+		list[i] = toGroup(g)
+	}
+	return &__.GroupList{Groups: list}, nil
+}
+
+func (s *Server) GetGroupInfo(ctx context.Context, req *__.GroupInfoRequest) (*__.Group, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	id := req.GetJid()
+	if gows.HasGroupSuffix(id) {
+		jid, err := parseGroupJID(id)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := cli.GetGroupInfo(jid)
+		if err != nil {
+			return nil, err
+		}
+		return toGroup(resp), nil
+	}
+	resp, err := cli.GetGroupInfoFromLink(id)
+	if err != nil {
+		return nil, err
+	}
+	return toGroup(resp), nil
+}
+
+func (s *Server) UpdateGroupParticipants(ctx context.Context, req *__.UpdateGroupParticipantsRequest) (*__.GroupParticipantList, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	participants, err := parseJIDs(req.GetParticipants())
+	if err != nil {
+		return nil, err
+	}
+
+	var action whatsmeow.ParticipantChange
+	switch req.Action {
+	case __.ParticipantAction_ADD:
+		action = whatsmeow.ParticipantChangeAdd
+	case __.ParticipantAction_REMOVE:
+		action = whatsmeow.ParticipantChangeRemove
+	case __.ParticipantAction_PROMOTE:
+		action = whatsmeow.ParticipantChangePromote
+	case __.ParticipantAction_DEMOTE:
+		action = whatsmeow.ParticipantChangeDemote
+	default:
+		return nil, errors.New("invalid participant action: " + req.Action.String())
+	}
+
+	resp, err := cli.UpdateGroupParticipants(jid, participants, action)
+	if err != nil {
+		return nil, err
+	}
+	return &__.GroupParticipantList{Participants: toParticipants(resp)}, nil
+}
+
+func (s *Server) SetGroupName(ctx context.Context, req *__.SetGroupNameRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	err = cli.SetGroupName(jid, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
+
+func (s *Server) SetGroupTopic(ctx context.Context, req *__.SetGroupTopicRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	// Empty previous and new ids - whatsmeow fetches the current topic id by itself
+	err = cli.SetGroupTopic(jid, "", "", req.GetTopic())
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
+
+func (s *Server) SetGroupPhoto(ctx context.Context, req *__.SetGroupPhotoRequest) (*__.SetGroupPhotoResponse, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	// Empty picture removes the current one
+	var picture []byte
+	if len(req.GetPicture()) != 0 {
+		picture = req.GetPicture()
+	}
+	pictureId, err := cli.SetGroupPhoto(jid, picture)
+	if err != nil {
+		return nil, err
+	}
+	return &__.SetGroupPhotoResponse{PictureId: pictureId}, nil
+}
+
+func (s *Server) LeaveGroup(ctx context.Context, req *__.LeaveGroupRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	err = cli.LeaveGroup(jid)
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
+
+func (s *Server) GetGroupInviteLink(ctx context.Context, req *__.GroupInviteLinkRequest) (*__.GroupInviteLink, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	link, err := cli.GetGroupInviteLink(jid, req.GetResetLink())
+	if err != nil {
+		return nil, err
+	}
+	return &__.GroupInviteLink{Link: link}, nil
+}
+
+func (s *Server) GetGroupInfoFromLink(ctx context.Context, req *__.GroupLinkRequest) (*__.Group, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.GetGroupInfoFromLink(req.GetLink())
+	if err != nil {
+		return nil, err
+	}
+	return toGroup(resp), nil
+}
+
+func (s *Server) JoinGroupWithLink(ctx context.Context, req *__.GroupLinkRequest) (*__.JoinGroupResponse, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := cli.JoinGroupWithLink(req.GetLink())
+	if err != nil {
+		return nil, err
+	}
+	return &__.JoinGroupResponse{Jid: jid.String()}, nil
+}
+
+type groupInvite struct {
+	jid        types.JID
+	inviter    types.JID
+	code       string
+	expiration int64
+}
+
+// parseGroupInvite gets the invite either from the invite message or from the explicit fields
+func parseGroupInvite(req *__.GroupInviteRequest) (*groupInvite, error) {
+	inviter, err := types.ParseJID(req.GetInviter())
+	if err != nil {
+		return nil, err
+	}
+	invite := &groupInvite{
+		inviter:    inviter,
+		code:       req.GetCode(),
+		expiration: req.GetExpiration(),
+	}
+	group := req.GetJid()
+	if req.GetMessage() != "" {
+		msg, err := BuildMessage(req.GetMessage())
+		if err != nil {
+			return nil, err
+		}
+		inviteMessage := msg.GetGroupInviteMessage()
+		if inviteMessage == nil {
+			return nil, errors.New("invalid message, not a group invite")
+		}
+		group = inviteMessage.GetGroupJID()
+		invite.code = inviteMessage.GetInviteCode()
+		invite.expiration = inviteMessage.GetInviteExpiration()
+	}
+	invite.jid, err = parseGroupJID(group)
+	if err != nil {
+		return nil, err
+	}
+	if invite.code == "" {
+		return nil, errors.New("invite code is required")
+	}
+	return invite, nil
+}
+
+func (s *Server) GetGroupInfoFromInvite(ctx context.Context, req *__.GroupInviteRequest) (*__.Group, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	invite, err := parseGroupInvite(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.GetGroupInfoFromInvite(invite.jid, invite.inviter, invite.code, invite.expiration)
+	if err != nil {
+		return nil, err
+	}
+	return toGroup(resp), nil
+}
+
+func (s *Server) JoinGroupWithInvite(ctx context.Context, req *__.GroupInviteRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	invite, err := parseGroupInvite(req)
+	if err != nil {
+		return nil, err
+	}
+	err = cli.JoinGroupWithInvite(invite.jid, invite.inviter, invite.code, invite.expiration)
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
+
+func (s *Server) GetGroupJoinRequests(ctx context.Context, req *__.GroupInfoRequest) (*__.GroupJoinRequestList, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.GetGroupRequestParticipants(jid)
+	if err != nil {
+		return nil, err
+	}
+	jids := make([]string, len(resp))
+	for i, j := range resp {
+		jids[i] = j.String()
+	}
+	return &__.GroupJoinRequestList{Jids: jids}, nil
+}
+
+func (s *Server) UpdateGroupJoinRequests(ctx context.Context, req *__.UpdateGroupJoinRequestsRequest) (*__.GroupParticipantList, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	participants, err := parseJIDs(req.GetParticipants())
+	if err != nil {
+		return nil, err
+	}
+
+	var action whatsmeow.ParticipantRequestChange
+	switch req.Action {
+	case __.JoinRequestAction_APPROVE:
+		action = whatsmeow.ParticipantChangeApprove
+	case __.JoinRequestAction_REJECT:
+		action = whatsmeow.ParticipantChangeReject
+	default:
+		return nil, errors.New("invalid join request action: " + req.Action.String())
+	}
+
+	resp, err := cli.UpdateGroupRequestParticipants(jid, participants, action)
+	if err != nil {
+		return nil, err
+	}
+	return &__.GroupParticipantList{Participants: toParticipants(resp)}, nil
+}
+
+func (s *Server) SetGroupJoinApprovalMode(ctx context.Context, req *__.SetGroupJoinApprovalModeRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	err = cli.SetGroupJoinApprovalMode(jid, req.GetEnabled())
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
+
+func (s *Server) SetGroupAnnounce(ctx context.Context, req *__.SetGroupAnnounceRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	err = cli.SetGroupAnnounce(jid, req.GetAnnounce())
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
+
+func (s *Server) SetGroupLocked(ctx context.Context, req *__.SetGroupLockedRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := parseGroupJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	err = cli.SetGroupLocked(jid, req.GetLocked())
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
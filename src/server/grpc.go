@@ -22,15 +22,43 @@ type Server struct {
 	log waLog.Logger
 
 	// session id -> id -> event channel
-	listeners     map[string]map[uuid.UUID]chan interface{}
+	listeners     map[string]map[uuid.UUID]*eventListener
+	allListeners  map[uuid.UUID]*eventListener
+	metrics       map[string]*eventMetrics
 	listenersLock sync.RWMutex
+
+	// session id -> event journal
+	journals     map[string]*eventJournal
+	journalsLock sync.RWMutex
+
+	// session id -> webhooks
+	webhooks     map[string]*webhookSender
+	webhooksLock sync.RWMutex
+
+	// session id -> closed when all session events are issued
+	consumers     map[string]chan struct{}
+	consumersLock sync.Mutex
+
+	// session id -> uploaded media
+	uploads     map[string]*sessionUploads
+	uploadsLock sync.Mutex
 }
 
 func NewServer() *Server {
 	return &Server{
 		Sm:            gows.NewSessionManager(),
 		log:           gowsLog.Stdout("gRPC", "INFO", false),
-		listeners:     map[string]map[uuid.UUID]chan interface{}{},
+		listeners:     map[string]map[uuid.UUID]*eventListener{},
+		allListeners:  map[uuid.UUID]*eventListener{},
+		metrics:       map[string]*eventMetrics{},
 		listenersLock: sync.RWMutex{},
+		journals:      map[string]*eventJournal{},
+		journalsLock:  sync.RWMutex{},
+		webhooks:      map[string]*webhookSender{},
+		webhooksLock:  sync.RWMutex{},
+		consumers:     map[string]chan struct{}{},
+		consumersLock: sync.Mutex{},
+		uploads:       map[string]*sessionUploads{},
+		uploadsLock:   sync.Mutex{},
 	}
 }
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"sync"
+	"time"
+)
+
+// journalBatchSize - how many events are read from the journal at once
+const journalBatchSize = 100
+
+// journalRetention - how long unacknowledged events are kept by default
+const journalRetention = 7 * 24 * time.Hour
+
+const journalCleanupInterval = 1 * time.Hour
+
+// journalWriteAttempts - how many times the event is written before giving up
+const journalWriteAttempts = 3
+
+const journalRetryDelay = 100 * time.Millisecond
+
+var ErrJournalDisabled = errors.New("event journal is not enabled for the session")
+var ErrJournalWriteFailed = errors.New("failed to save event to journal, resume from the last received sequence")
+
+var journalSchema = []string{
+	`CREATE TABLE IF NOT EXISTS gows_events (
+		session    TEXT   NOT NULL,
+		seq        BIGINT NOT NULL,
+		event      TEXT   NOT NULL,
+		chat       TEXT   NOT NULL,
+		from_me    BOOLEAN,
+		data       TEXT   NOT NULL,
+		created_at BIGINT NOT NULL,
+		PRIMARY KEY (session, seq)
+	)`,
+	// The last sequence number, kept when the events are removed
+	`CREATE TABLE IF NOT EXISTS gows_event_sequences (
+		session TEXT   PRIMARY KEY,
+		seq     BIGINT NOT NULL
+	)`,
+}
+
+// eventJournal keeps the session events in the session store database
+// until they're acknowledged, so they can be sent again after reconnect
+type eventJournal struct {
+	db        *sql.DB
+	session   string
+	retention time.Duration
+	stop      chan struct{}
+	log       waLog.Logger
+
+	lock sync.Mutex
+	// the last issued sequence number, never decreases
+	seq uint64
+}
+
+type journalEntry struct {
+	Sequence uint64
+	Event    string
+	Source   eventSource
+	Data     string
+}
+
+func openEventJournal(dialect string, address string, session string, retention time.Duration, log waLog.Logger) (*eventJournal, error) {
+	db, err := sql.Open(dialect, address)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range journalSchema {
+		_, err = db.Exec(query)
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	if retention == 0 {
+		retention = journalRetention
+	}
+	journal := &eventJournal{
+		db:        db,
+		session:   session,
+		retention: retention,
+		stop:      make(chan struct{}),
+		log:       log,
+	}
+	err = db.QueryRow(
+		`SELECT COALESCE(MAX(seq), 0) FROM (
+			SELECT MAX(seq) AS seq FROM gows_events WHERE session = $1
+			UNION ALL
+			SELECT seq FROM gows_event_sequences WHERE session = $1
+		) AS sequences`,
+		session,
+	).Scan(&journal.seq)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	go journal.cleanupLoop()
+	return journal, nil
+}
+
+// append saves the event and returns its sequence number
+func (j *eventJournal) append(event string, source eventSource, data string) (uint64, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	seq := j.seq + 1
+	var err error
+	for attempt := 0; attempt < journalWriteAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(journalRetryDelay * time.Duration(attempt))
+		}
+		_, err = j.db.Exec(
+			"INSERT INTO gows_events (session, seq, event, chat, from_me, data, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			j.session, seq, event, source.Chat, source.FromMe, data, time.Now().Unix(),
+		)
+		if err == nil {
+			j.seq = seq
+			return seq, nil
+		}
+	}
+	return 0, err
+}
+
+// replay calls fn for all events after the sequence number, in order
+func (j *eventJournal) replay(after uint64, fn func(entry journalEntry) error) error {
+	for {
+		entries, err := j.read(after)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err = fn(entry)
+			if err != nil {
+				return err
+			}
+			after = entry.Sequence
+		}
+		if len(entries) < journalBatchSize {
+			return nil
+		}
+	}
+}
+
+// read reads a batch of events, so the database is not locked while they're sent
+func (j *eventJournal) read(after uint64) ([]journalEntry, error) {
+	rows, err := j.db.Query(
+		"SELECT seq, event, chat, from_me, data FROM gows_events WHERE session = $1 AND seq > $2 ORDER BY seq LIMIT $3",
+		j.session, after, journalBatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]journalEntry, 0, journalBatchSize)
+	for rows.Next() {
+		var entry journalEntry
+		var fromMe sql.NullBool
+		err = rows.Scan(&entry.Sequence, &entry.Event, &entry.Source.Chat, &fromMe, &entry.Data)
+		if err != nil {
+			return nil, err
+		}
+		if fromMe.Valid {
+			entry.Source.FromMe = &fromMe.Bool
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ack removes the events up to the sequence number - they're delivered
+func (j *eventJournal) ack(seq uint64) error {
+	return j.remove("DELETE FROM gows_events WHERE session = $1 AND seq <= $2", seq)
+}
+
+// cleanup removes the events older than the retention period, even if they're not acknowledged
+func (j *eventJournal) cleanup() error {
+	before := time.Now().Add(-j.retention).Unix()
+	return j.remove("DELETE FROM gows_events WHERE session = $1 AND created_at < $2", before)
+}
+
+// remove runs the delete query, saving the last sequence number first,
+// so the numbers continue after restart even if all the events are removed
+func (j *eventJournal) remove(query string, arg interface{}) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	tx, err := j.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(
+		`INSERT INTO gows_event_sequences (session, seq) VALUES ($1, $2)
+		ON CONFLICT (session) DO UPDATE SET seq = excluded.seq`,
+		j.session, j.seq,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, j.session, arg)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (j *eventJournal) cleanupLoop() {
+	ticker := time.NewTicker(journalCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			err := j.cleanup()
+			if err != nil {
+				j.log.Errorf("Failed to clean up event journal: %v", err)
+			}
+		}
+	}
+}
+
+func (j *eventJournal) close() error {
+	close(j.stop)
+	return j.db.Close()
+}
+
+func (s *Server) getJournal(session string) *eventJournal {
+	s.journalsLock.RLock()
+	defer s.journalsLock.RUnlock()
+	return s.journals[session]
+}
+
+func (s *Server) startJournal(session string, dialect string, address string, retention time.Duration) error {
+	s.journalsLock.Lock()
+	defer s.journalsLock.Unlock()
+	if _, ok := s.journals[session]; ok {
+		return nil
+	}
+	journal, err := openEventJournal(dialect, address, session, retention, s.log.Sub("Journal"))
+	if err != nil {
+		return err
+	}
+	s.journals[session] = journal
+	return nil
+}
+
+func (s *Server) stopJournal(session string) {
+	s.journalsLock.Lock()
+	defer s.journalsLock.Unlock()
+	journal, ok := s.journals[session]
+	if !ok {
+		return
+	}
+	delete(s.journals, session)
+	err := journal.close()
+	if err != nil {
+		s.log.Errorf("Error closing event journal: %v", err)
+	}
+}
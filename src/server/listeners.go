@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// listenerQueueSize - how many events a listener can lag behind by default
+const listenerQueueSize = 100
+
+// listenerBlockTimeout - how long a BLOCK listener can hold the session events,
+// it's disconnected after
+const listenerBlockTimeout = 5 * time.Second
+
+var ErrListenerTooSlow = errors.New("listener is too slow, events queue overflowed")
+
+// eventMetrics counts the session events
+type eventMetrics struct {
+	issued          atomic.Uint64
+	dropped         atomic.Uint64
+	disconnected    atomic.Uint64
+	journalFailures atomic.Uint64
+}
+
+// eventListener is a bounded queue of events for one stream
+type eventListener struct {
+	queue chan *issuedEvent
+	// closed when the listener is removed or disconnected
+	done      chan struct{}
+	closeOnce sync.Once
+	// why the listener is closed, nil - overflow
+	err error
+
+	overflow __.OverflowPolicy
+	filter   *eventFilter
+	// nil - all sessions, for StreamAllEvents listeners
+	sessions map[string]bool
+	metrics  *eventMetrics
+}
+
+func newEventListener(queueSize uint32, overflow __.OverflowPolicy, filter *eventFilter, metrics *eventMetrics) *eventListener {
+	size := int(queueSize)
+	if size == 0 {
+		size = listenerQueueSize
+	}
+	return &eventListener{
+		queue:    make(chan *issuedEvent, size),
+		done:     make(chan struct{}),
+		overflow: overflow,
+		filter:   filter,
+		metrics:  metrics,
+	}
+}
+
+func (l *eventListener) close() {
+	l.closeWith(nil)
+}
+
+func (l *eventListener) closeWith(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+// closeError is the error the stream ends with when the listener is closed
+func (l *eventListener) closeError() error {
+	if l.err != nil {
+		return l.err
+	}
+	return status.Error(codes.ResourceExhausted, ErrListenerTooSlow.Error())
+}
+
+// send queues the event, applying the overflow policy if the queue is full
+func (l *eventListener) send(event *issuedEvent) {
+	select {
+	case <-l.done:
+		return
+	default:
+	}
+	if l.sessions != nil && !l.sessions[event.Session] {
+		return
+	}
+	if !l.filter.match(event.Type, event.Source) {
+		return
+	}
+
+	switch l.overflow {
+	case __.OverflowPolicy_BLOCK:
+		// Blocks the session event handler, so wait for a limited time only
+		timer := time.NewTimer(listenerBlockTimeout)
+		defer timer.Stop()
+		select {
+		case l.queue <- event:
+		case <-l.done:
+		case <-timer.C:
+			l.metrics.dropped.Add(1)
+			l.metrics.disconnected.Add(1)
+			l.close()
+		}
+	case __.OverflowPolicy_DISCONNECT:
+		select {
+		case l.queue <- event:
+		default:
+			l.metrics.dropped.Add(1)
+			l.metrics.disconnected.Add(1)
+			l.close()
+		}
+	default:
+		for {
+			select {
+			case l.queue <- event:
+				return
+			default:
+			}
+			// Drop the oldest event to make room
+			select {
+			case <-l.queue:
+				l.metrics.dropped.Add(1)
+			default:
+			}
+		}
+	}
+}
+
+func (s *Server) addListener(session string, id uuid.UUID, listener *eventListener) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	sessionListeners, ok := s.listeners[session]
+	if !ok {
+		sessionListeners = map[uuid.UUID]*eventListener{}
+		s.listeners[session] = sessionListeners
+	}
+	sessionListeners[id] = listener
+}
+
+func (s *Server) removeListener(session string, id uuid.UUID) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	listener, ok := s.listeners[session][id]
+	if !ok {
+		return
+	}
+	delete(s.listeners[session], id)
+	// if it's the last listener, remove the session
+	if len(s.listeners[session]) == 0 {
+		delete(s.listeners, session)
+	}
+	listener.close()
+}
+
+func (s *Server) getListeners(session string) []*eventListener {
+	s.listenersLock.RLock()
+	defer s.listenersLock.RUnlock()
+	listeners := make([]*eventListener, 0, len(s.listeners[session]))
+	for _, listener := range s.listeners[session] {
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+func (s *Server) addAllListener(id uuid.UUID, listener *eventListener) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	s.allListeners[id] = listener
+}
+
+func (s *Server) removeAllListener(id uuid.UUID) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	listener, ok := s.allListeners[id]
+	if !ok {
+		return
+	}
+	delete(s.allListeners, id)
+	listener.close()
+}
+
+func (s *Server) getAllListeners() []*eventListener {
+	s.listenersLock.RLock()
+	defer s.listenersLock.RUnlock()
+	listeners := make([]*eventListener, 0, len(s.allListeners))
+	for _, listener := range s.allListeners {
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+// getMetrics gets the metrics, creating them if needed
+func (s *Server) getMetrics(session string) *eventMetrics {
+	s.listenersLock.RLock()
+	metrics, ok := s.metrics[session]
+	s.listenersLock.RUnlock()
+	if ok {
+		return metrics
+	}
+
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	metrics, ok = s.metrics[session]
+	if !ok {
+		metrics = &eventMetrics{}
+		s.metrics[session] = metrics
+	}
+	return metrics
+}
+
+// lookupMetrics gets the metrics without creating them
+func (s *Server) lookupMetrics(session string) *eventMetrics {
+	s.listenersLock.RLock()
+	defer s.listenersLock.RUnlock()
+	metrics, ok := s.metrics[session]
+	if !ok {
+		return &eventMetrics{}
+	}
+	return metrics
+}
+
+// stopMetrics removes the metrics of the stopped session
+func (s *Server) stopMetrics(session string) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	delete(s.metrics, session)
+}
+
+func (s *Server) GetEventMetrics(ctx context.Context, req *__.Session) (*__.EventMetrics, error) {
+	// Empty id - StreamAllEvents listeners
+	name := req.GetId()
+	metrics := s.lookupMetrics(name)
+	return &__.EventMetrics{
+		Issued:          metrics.issued.Load(),
+		Dropped:         metrics.dropped.Load(),
+		Disconnected:    metrics.disconnected.Load(),
+		JournalFailures: metrics.journalFailures.Load(),
+		Listeners:       uint32(s.countListeners(name)),
+	}, nil
+}
+
+func (s *Server) countListeners(session string) int {
+	s.listenersLock.RLock()
+	defer s.listenersLock.RUnlock()
+	if session == "" {
+		return len(s.allListeners)
+	}
+	return len(s.listeners[session])
+}
@@ -3,25 +3,234 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"github.com/devlikeapro/gows/gows"
 	"github.com/devlikeapro/gows/proto"
+	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"os"
 )
 
 func (s *Server) DownloadMedia(ctx context.Context, req *__.DownloadMediaRequest) (*__.DownloadMediaResponse, error) {
+	content, err := s.downloadMedia(ctx, req)
+	if err != nil {
+		s.log.Errorf("Failed to download media: %v", err)
+		return nil, toDownloadError(err)
+	}
+	return &__.DownloadMediaResponse{Content: content}, nil
+}
+
+func (s *Server) downloadMedia(ctx context.Context, req *__.DownloadMediaRequest) ([]byte, error) {
 	cli, err := s.Sm.Get(req.GetSession().GetId())
 	if err != nil {
 		return nil, err
 	}
-	msg, err := BuildMessage(req.GetMessage())
+	msg, info, err := parseDownloadRequest(req)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := cli.DownloadAny(msg)
+	if info == nil {
+		return cli.DownloadAny(msg)
+	}
+	return cli.DownloadAnyWithRetry(ctx, msg, info)
+}
+
+// parseDownloadRequest gets the message to download and,
+// if the retry is requested, its info
+func parseDownloadRequest(req *__.DownloadMediaRequest) (*waE2E.Message, *types.MessageInfo, error) {
+	msg, err := BuildMessage(req.GetMessage())
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid message: %v", err)
+	}
+	if !req.GetRetry() {
+		return msg, nil, nil
+	}
+	var info types.MessageInfo
+	err = json.Unmarshal([]byte(req.GetInfo()), &info)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid message info: %v", err)
+	}
+	return msg, &info, nil
+}
+
+// toDownloadError converts the download error to gRPC status error
+func toDownloadError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, gows.ErrSessionNotFound):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case gows.IsMediaExpired(err),
+		errors.Is(err, whatsmeow.ErrMediaNotAvailableOnPhone),
+		errors.Is(err, gows.ErrMediaRetryFailed):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, whatsmeow.ErrInvalidMediaHMAC),
+		errors.Is(err, whatsmeow.ErrInvalidMediaEncSHA256),
+		errors.Is(err, whatsmeow.ErrInvalidMediaSHA256),
+		errors.Is(err, whatsmeow.ErrFileLengthMismatch),
+		errors.Is(err, whatsmeow.ErrTooShortFile):
+		return status.Error(codes.DataLoss, err.Error())
+	case errors.Is(err, whatsmeow.ErrNothingDownloadableFound),
+		errors.Is(err, whatsmeow.ErrUnknownMediaType),
+		errors.Is(err, whatsmeow.ErrNoURLPresent):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, gows.ErrMediaRetryTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// mediaChunkSize is the size of content chunks for streaming media
+const mediaChunkSize = 1024 * 1024
+
+func (s *Server) DownloadMediaStream(req *__.DownloadMediaRequest, stream grpc.ServerStreamingServer[__.DownloadMediaChunk]) error {
+	file, err := s.downloadMediaToFile(stream.Context(), req)
 	if err != nil {
 		s.log.Errorf("Failed to download media: %v", err)
-		return nil, nil
+		return toDownloadError(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	buf := make([]byte, mediaChunkSize)
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			sendErr := stream.Send(&__.DownloadMediaChunk{Content: buf[:n]})
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// downloadMediaToFile downloads the media into a temp file, so large media
+// are not kept in memory. The file is positioned at the start,
+// the caller must close and remove it
+func (s *Server) downloadMediaToFile(ctx context.Context, req *__.DownloadMediaRequest) (*os.File, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	msg, info, err := parseDownloadRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp("", "gows-download-*")
+	if err != nil {
+		return nil, err
+	}
+	err = cli.DownloadAnyToFile(ctx, msg, info, file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *Server) UploadMedia(stream grpc.ClientStreamingServer[__.UploadMediaChunk, __.MediaHandle]) error {
+	chunk, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := chunk.GetHeader()
+	if header == nil {
+		return errors.New("the first chunk must be the header")
+	}
+	cli, err := s.Sm.Get(header.GetSession().GetId())
+	if err != nil {
+		return err
+	}
+	jid := types.EmptyJID
+	if header.GetJid() != "" {
+		jid, err = types.ParseJID(header.GetJid())
+		if err != nil {
+			return err
+		}
+	}
+	mediaType, err := toWhatsmeowMediaType(header.GetType())
+	if err != nil {
+		return err
+	}
+
+	// Keep the content on disk, not in memory
+	file, err := os.CreateTemp("", "gows-upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	for {
+		chunk, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(chunk.GetContent())
+		if err != nil {
+			return err
+		}
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cli.UploadMediaReader(stream.Context(), jid, file, mediaType)
+	if err != nil {
+		return err
+	}
+	uploaded := &uploadedMedia{
+		UploadResponse: resp,
+		Type:           header.GetType(),
+		Mimetype:       header.GetMimetype(),
+		Filename:       header.GetFilename(),
+		Thumbnail:      header.GetThumbnail(),
+	}
+	id := s.getUploads(header.GetSession().GetId()).handles.add(uploaded)
+	return stream.SendAndClose(&__.MediaHandle{Id: id, Reference: toMediaReference(uploaded)})
+}
+
+func (s *Server) PrepareMedia(ctx context.Context, req *__.PrepareMediaRequest) (*__.MediaReference, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid := types.EmptyJID
+	if req.GetJid() != "" {
+		jid, err = types.ParseJID(req.GetJid())
+		if err != nil {
+			return nil, err
+		}
+	}
+	reqMedia := req.GetMedia()
+	if reqMedia == nil {
+		return nil, errors.New("media is required")
+	}
+	uploaded, err := s.uploadMedia(ctx, cli, jid, reqMedia)
+	if err != nil {
+		return nil, err
 	}
-	return &__.DownloadMediaResponse{Content: resp}, nil
+	return toMediaReference(uploaded), nil
 }
 
 // BuildMessage builds a message from the given JSON data
@@ -3,6 +3,8 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/devlikeapro/gows/gows"
 	"github.com/devlikeapro/gows/media"
 	"github.com/devlikeapro/gows/proto"
 	"github.com/golang/protobuf/proto"
@@ -25,7 +27,22 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 	message := waE2E.Message{}
 	mediaResponse := whatsmeow.UploadResponse{}
 
-	if req.Media == nil {
+	switch {
+	case req.Location != nil:
+		message.LocationMessage = buildLocationMessage(req.Location, req.Text)
+	case req.LiveLocation != nil:
+		message.LiveLocationMessage = buildLiveLocationMessage(req.LiveLocation, req.Text)
+	case len(req.Contacts) != 0:
+		contacts := buildContactMessages(req.Contacts)
+		if len(contacts) == 1 {
+			message.ContactMessage = contacts[0]
+		} else {
+			message.ContactsArrayMessage = &waE2E.ContactsArrayMessage{
+				DisplayName: proto.String(fmt.Sprintf("%d contacts", len(contacts))),
+				Contacts:    contacts,
+			}
+		}
+	case req.Media == nil:
 		var backgroundArgb *uint32
 		if req.BackgroundColor != nil {
 			backgroundArgb, err = media.ParseColor(req.BackgroundColor.Value)
@@ -44,152 +61,432 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 			BackgroundArgb: backgroundArgb,
 			Font:           font,
 		}
-	} else {
-		var mediaType whatsmeow.MediaType
-		switch req.Media.Type {
-		case __.MediaType_IMAGE:
-			// Upload
-			mediaType = whatsmeow.MediaImage
-			mediaResponse, err = cli.UploadMedia(ctx, jid, req.Media.Content, mediaType)
-			if err != nil {
-				return nil, err
-			}
+	case req.Media.Handle != "":
+		uploaded, err := s.getUploads(req.GetSession().GetId()).handles.get(req.Media.Handle)
+		if err != nil {
+			return nil, err
+		}
+		mediaResponse = uploaded.UploadResponse
+		setUploadedMedia(&message, uploaded, req.Media, req.Text)
+	case req.Media.Reference != nil:
+		uploaded := fromMediaReference(req.Media.Reference)
+		mediaResponse = uploaded.UploadResponse
+		setUploadedMedia(&message, uploaded, req.Media, req.Text)
+	default:
+		uploaded, err := s.uploadMedia(ctx, cli, jid, req.Media)
+		if err != nil {
+			return nil, err
+		}
+		mediaResponse = uploaded.UploadResponse
+		setUploadedMedia(&message, uploaded, req.Media, req.Text)
+	}
 
-			// Generate Thumbnail
-			thumbnail, err := media.ImageThumbnail(req.Media.Content)
-			if err != nil {
-				s.log.Errorf("Failed to generate thumbnail: %v", err)
-			}
-			// Attach
-			message.ImageMessage = &waE2E.ImageMessage{
-				Caption:       proto.String(req.Text),
-				Mimetype:      proto.String(req.Media.Mimetype),
-				JPEGThumbnail: thumbnail,
-				URL:           &mediaResponse.URL,
-				DirectPath:    &mediaResponse.DirectPath,
-				FileSHA256:    mediaResponse.FileSHA256,
-				FileLength:    &mediaResponse.FileLength,
-				MediaKey:      mediaResponse.MediaKey,
-				FileEncSHA256: mediaResponse.FileEncSHA256,
-			}
-		case __.MediaType_AUDIO:
-			mediaType = whatsmeow.MediaAudio
-			var waveform []byte
-			var duration float32
-			// Get waveform and duration if available
-			if req.Media.Audio != nil {
-				waveform = req.Media.Audio.Waveform
-				duration = req.Media.Audio.Duration
-			}
+	mentions, err := buildMentions(cli, jid, req)
+	if err != nil {
+		return nil, err
+	}
+	contextInfo, err := buildContextInfo(req, mentions)
+	if err != nil {
+		return nil, err
+	}
+	setContextInfo(&message, contextInfo)
 
-			if waveform == nil || len(waveform) == 0 {
-				// Generate waveform
-				waveform, err = media.Waveform(req.Media.Content)
-				if err != nil {
-					s.log.Errorf("Failed to generate waveform: %v", err)
-				}
-			}
-			if duration == 0 {
-				// Get duration
-				duration, err = media.Duration(req.Media.Content)
-				if err != nil {
-					s.log.Errorf("Failed to get duration of audio: %v", err)
-				}
-			}
-			durationSeconds := uint32(duration)
+	extra := whatsmeow.SendRequestExtra{}
+	if mediaResponse.Handle != "" {
+		// Newsletters
+		extra.MediaHandle = mediaResponse.Handle
+	}
+
+	res, err := cli.SendMessage(ctx, jid, &message, extra)
+	if err != nil {
+		return nil, err
+	}
+
+	return &__.MessageResponse{Id: res.ID, Timestamp: res.Timestamp.Unix()}, nil
+}
+
+// buildMentions returns the list of mentioned jids, all group participants for mentionAll
+func buildMentions(cli *gows.GoWS, jid types.JID, req *__.MessageRequest) ([]string, error) {
+	if req.GetMentionAll() {
+		if !gows.IsGroup(jid) {
+			return nil, errors.New("mention all is available only in groups")
+		}
+		info, err := cli.GetGroupInfo(jid)
+		if err != nil {
+			return nil, err
+		}
+		mentions := make([]string, 0, len(info.Participants))
+		for _, p := range info.Participants {
+			mentions = append(mentions, p.JID.ToNonAD().String())
+		}
+		return mentions, nil
+	}
 
-			// Upload
-			mediaResponse, err = cli.UploadMedia(ctx, jid, req.Media.Content, mediaType)
+	mentions := make([]string, len(req.GetMentions()))
+	for i, m := range req.GetMentions() {
+		mentioned, err := types.ParseJID(m)
+		if err != nil {
+			return nil, err
+		}
+		mentions[i] = mentioned.ToNonAD().String()
+	}
+	return mentions, nil
+}
+
+// buildContextInfo builds the context info (reply, mentions) for the message, nil if there's nothing to attach
+func buildContextInfo(req *__.MessageRequest, mentions []string) (*waE2E.ContextInfo, error) {
+	replyTo := req.GetReplyTo()
+	hasReply := replyTo != nil && replyTo.GetMessageId() != ""
+	if !hasReply && len(mentions) == 0 {
+		return nil, nil
+	}
+
+	contextInfo := &waE2E.ContextInfo{}
+	if len(mentions) != 0 {
+		contextInfo.MentionedJID = mentions
+	}
+	if !hasReply {
+		return contextInfo, nil
+	}
+
+	contextInfo.StanzaID = proto.String(replyTo.GetMessageId())
+	if replyTo.GetParticipant() != "" {
+		participant, err := types.ParseJID(replyTo.GetParticipant())
+		if err != nil {
+			return nil, err
+		}
+		contextInfo.Participant = proto.String(participant.ToNonAD().String())
+	}
+	if replyTo.GetMessage() != "" {
+		quoted, err := BuildMessage(replyTo.GetMessage())
+		if err != nil {
+			return nil, err
+		}
+		contextInfo.QuotedMessage = quoted
+	}
+	return contextInfo, nil
+}
+
+// setContextInfo attaches the context info to the message content
+func setContextInfo(message *waE2E.Message, contextInfo *waE2E.ContextInfo) {
+	if contextInfo == nil {
+		return
+	}
+	switch {
+	case message.ExtendedTextMessage != nil:
+		message.ExtendedTextMessage.ContextInfo = contextInfo
+	case message.ImageMessage != nil:
+		message.ImageMessage.ContextInfo = contextInfo
+	case message.VideoMessage != nil:
+		message.VideoMessage.ContextInfo = contextInfo
+	case message.AudioMessage != nil:
+		message.AudioMessage.ContextInfo = contextInfo
+	case message.DocumentMessage != nil:
+		message.DocumentMessage.ContextInfo = contextInfo
+	case message.StickerMessage != nil:
+		message.StickerMessage.ContextInfo = contextInfo
+	case message.LocationMessage != nil:
+		message.LocationMessage.ContextInfo = contextInfo
+	case message.LiveLocationMessage != nil:
+		message.LiveLocationMessage.ContextInfo = contextInfo
+	case message.ContactMessage != nil:
+		message.ContactMessage.ContextInfo = contextInfo
+	case message.ContactsArrayMessage != nil:
+		message.ContactsArrayMessage.ContextInfo = contextInfo
+	}
+}
+
+// processMedia converts the media content to what WhatsApp expects, gets its metadata and uploads it
+func (s *Server) processMedia(ctx context.Context, cli *gows.GoWS, jid types.JID, reqMedia *__.Media) (*uploadedMedia, error) {
+	mediaType, err := toWhatsmeowMediaType(reqMedia.Type)
+	if err != nil {
+		return nil, err
+	}
+	uploaded := &uploadedMedia{
+		Type:     reqMedia.Type,
+		Mimetype: reqMedia.Mimetype,
+		Filename: reqMedia.Filename,
+	}
+	content := reqMedia.Content
+
+	switch reqMedia.Type {
+	case __.MediaType_IMAGE:
+		// Rotate, resize and recompress if required
+		image, err := media.PrepareImage(
+			content,
+			reqMedia.Mimetype,
+			reqMedia.GetImage().GetMaxSide(),
+			reqMedia.GetImage().GetMaxBytes(),
+		)
+		if err != nil {
+			s.log.Errorf("Failed to prepare image, sending as is: %v", err)
+			image = &media.Image{Content: content, Mimetype: reqMedia.Mimetype}
+		}
+		content = image.Content
+		uploaded.Mimetype = image.Mimetype
+		uploaded.Width = image.Width
+		uploaded.Height = image.Height
+
+		// Generate Thumbnail
+		uploaded.Thumbnail, err = media.ImageThumbnail(content)
+		if err != nil {
+			s.log.Errorf("Failed to generate thumbnail: %v", err)
+		}
+	case __.MediaType_AUDIO:
+		if reqMedia.Convert {
+			content, err = media.ConvertToOpus(content)
 			if err != nil {
 				return nil, err
 			}
+			uploaded.Mimetype = "audio/ogg; codecs=opus"
+		}
 
-			// Attach
-			ptt := true
-			message.AudioMessage = &waE2E.AudioMessage{
-				Mimetype:      proto.String(req.Media.Mimetype),
-				URL:           &mediaResponse.URL,
-				DirectPath:    &mediaResponse.DirectPath,
-				MediaKey:      mediaResponse.MediaKey,
-				FileEncSHA256: mediaResponse.FileEncSHA256,
-				FileSHA256:    mediaResponse.FileSHA256,
-				FileLength:    &mediaResponse.FileLength,
-				Seconds:       &durationSeconds,
-				Waveform:      waveform,
-				PTT:           &ptt,
+		// Get waveform and duration if available
+		var duration float32
+		if reqMedia.Audio != nil {
+			uploaded.Waveform = reqMedia.Audio.Waveform
+			duration = reqMedia.Audio.Duration
+		}
+		if len(uploaded.Waveform) == 0 {
+			// Generate waveform
+			uploaded.Waveform, err = media.Waveform(content)
+			if err != nil {
+				s.log.Errorf("Failed to generate waveform: %v", err)
 			}
-		case __.MediaType_VIDEO:
-			mediaType = whatsmeow.MediaVideo
-			// Upload
-			mediaResponse, err = cli.UploadMedia(ctx, jid, req.Media.Content, mediaType)
+		}
+		if duration == 0 {
+			// Get duration
+			duration, err = media.Duration(content)
+			if err != nil {
+				s.log.Errorf("Failed to get duration of audio: %v", err)
+			}
+		}
+		uploaded.Seconds = uint32(duration)
+	case __.MediaType_VIDEO:
+		if reqMedia.Convert {
+			content, err = media.ConvertToMp4(content)
 			if err != nil {
 				return nil, err
 			}
+			uploaded.Mimetype = "video/mp4"
+		}
 
-			// Generate Thumbnail
-			thumbnail, err := media.VideoThumbnail(
-				req.Media.Content,
-				0,
-				struct{ Width int }{Width: 72},
-			)
+		// Generate Thumbnail
+		uploaded.Thumbnail, err = media.VideoThumbnail(
+			content,
+			0,
+			struct{ Width int }{Width: 72},
+		)
+		if err != nil {
+			s.log.Infof("Failed to generate video thumbnail: %v", err)
+		}
 
+		// Get duration and dimensions
+		info, err := media.VideoMetadata(content)
+		if err != nil {
+			s.log.Infof("Failed to get video metadata: %v", err)
+		} else {
+			uploaded.Seconds = uint32(info.Duration)
+			uploaded.Width = info.Width
+			uploaded.Height = info.Height
+		}
+	case __.MediaType_DOCUMENT:
+		// Generate Thumbnail if possible - first page for PDF
+		preview, err := media.DocumentThumbnail(content)
+		if err != nil {
+			s.log.Infof("Failed to generate thumbnail: %v", err)
+		} else {
+			uploaded.Thumbnail = preview.Thumbnail
+			uploaded.ThumbnailWidth = preview.Width
+			uploaded.ThumbnailHeight = preview.Height
+		}
+
+		if media.IsPdf(content) {
+			uploaded.PageCount, err = media.PdfPageCount(content)
 			if err != nil {
-				s.log.Infof("Failed to generate video thumbnail: %v", err)
+				s.log.Infof("Failed to get page count: %v", err)
 			}
+		}
+	case __.MediaType_STICKER:
+		// Convert to WebP
+		sticker, err := media.StickerWebp(content)
+		if err != nil {
+			return nil, err
+		}
+		content = sticker.Content
+		uploaded.Mimetype = "image/webp"
+		uploaded.Width = sticker.Width
+		uploaded.Height = sticker.Height
+		uploaded.Animated = sticker.Animated
+	}
 
-			message.VideoMessage = &waE2E.VideoMessage{
-				Caption:       proto.String(req.Text),
-				Mimetype:      proto.String(req.Media.Mimetype),
-				URL:           &mediaResponse.URL,
-				DirectPath:    &mediaResponse.DirectPath,
-				MediaKey:      mediaResponse.MediaKey,
-				FileEncSHA256: mediaResponse.FileEncSHA256,
-				FileSHA256:    mediaResponse.FileSHA256,
-				FileLength:    &mediaResponse.FileLength,
-				JPEGThumbnail: thumbnail,
-			}
+	// Upload
+	uploaded.UploadResponse, err = cli.UploadMedia(ctx, jid, content, mediaType)
+	if err != nil {
+		return nil, err
+	}
 
-		case __.MediaType_DOCUMENT:
-			mediaType = whatsmeow.MediaDocument
-			// Upload
-			mediaResponse, err = cli.UploadMedia(ctx, jid, req.Media.Content, mediaType)
-			if err != nil {
-				return nil, err
-			}
+	// Newsletter media is not encrypted, so there's no sidecar
+	if reqMedia.Type == __.MediaType_VIDEO && len(uploaded.MediaKey) != 0 {
+		uploaded.StreamingSidecar, err = gows.StreamingSidecar(content, uploaded.UploadResponse, mediaType)
+		if err != nil {
+			s.log.Infof("Failed to build streaming sidecar: %v", err)
+		}
+	}
+	return uploaded, nil
+}
 
-			// Generate Thumbnail if possible
-			thumbnail, err := media.ImageThumbnail(req.Media.Content)
-			if err != nil {
-				s.log.Infof("Failed to generate thumbnail: %v", err)
-			}
+// optionalUint32 returns nil for 0 - unknown value
+func optionalUint32(value uint32) *uint32 {
+	if value == 0 {
+		return nil
+	}
+	return &value
+}
 
-			// Attach
-			message.DocumentMessage = &waE2E.DocumentMessage{
-				Caption:       proto.String(req.Text),
-				Mimetype:      proto.String(req.Media.Mimetype),
-				URL:           &mediaResponse.URL,
-				DirectPath:    &mediaResponse.DirectPath,
-				MediaKey:      mediaResponse.MediaKey,
-				FileEncSHA256: mediaResponse.FileEncSHA256,
-				FileSHA256:    mediaResponse.FileSHA256,
-				FileLength:    &mediaResponse.FileLength,
-				JPEGThumbnail: thumbnail,
+// setUploadedMedia attaches the media uploaded in advance to the message
+func setUploadedMedia(message *waE2E.Message, uploaded *uploadedMedia, reqMedia *__.Media, text string) {
+	switch uploaded.Type {
+	case __.MediaType_IMAGE:
+		message.ImageMessage = &waE2E.ImageMessage{
+			Caption:       proto.String(text),
+			Mimetype:      proto.String(uploaded.Mimetype),
+			Width:         optionalUint32(uploaded.Width),
+			Height:        optionalUint32(uploaded.Height),
+			JPEGThumbnail: uploaded.Thumbnail,
+			URL:           &uploaded.URL,
+			DirectPath:    &uploaded.DirectPath,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    &uploaded.FileLength,
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+		}
+	case __.MediaType_AUDIO:
+		ptt := true
+		durationSeconds := uploaded.Seconds
+		waveform := uploaded.Waveform
+		// Values from the request take precedence
+		if reqMedia.Audio != nil {
+			if reqMedia.Audio.Duration != 0 {
+				durationSeconds = uint32(reqMedia.Audio.Duration)
+			}
+			if len(reqMedia.Audio.Waveform) != 0 {
+				waveform = reqMedia.Audio.Waveform
 			}
+			if reqMedia.Audio.Ptt != nil {
+				ptt = reqMedia.Audio.Ptt.Value
+			}
+		}
+		message.AudioMessage = &waE2E.AudioMessage{
+			Mimetype:      proto.String(uploaded.Mimetype),
+			URL:           &uploaded.URL,
+			DirectPath:    &uploaded.DirectPath,
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    &uploaded.FileLength,
+			Seconds:       &durationSeconds,
+			Waveform:      waveform,
+			PTT:           &ptt,
+		}
+	case __.MediaType_VIDEO:
+		message.VideoMessage = &waE2E.VideoMessage{
+			Caption:          proto.String(text),
+			Mimetype:         proto.String(uploaded.Mimetype),
+			Seconds:          optionalUint32(uploaded.Seconds),
+			Width:            optionalUint32(uploaded.Width),
+			Height:           optionalUint32(uploaded.Height),
+			GifPlayback:      proto.Bool(reqMedia.GetVideo().GetGifPlayback()),
+			URL:              &uploaded.URL,
+			DirectPath:       &uploaded.DirectPath,
+			MediaKey:         uploaded.MediaKey,
+			FileEncSHA256:    uploaded.FileEncSHA256,
+			FileSHA256:       uploaded.FileSHA256,
+			FileLength:       &uploaded.FileLength,
+			JPEGThumbnail:    uploaded.Thumbnail,
+			StreamingSidecar: uploaded.StreamingSidecar,
+		}
+	case __.MediaType_DOCUMENT:
+		var fileName *string
+		if uploaded.Filename != "" {
+			fileName = proto.String(uploaded.Filename)
+		}
+		message.DocumentMessage = &waE2E.DocumentMessage{
+			Caption:         proto.String(text),
+			Mimetype:        proto.String(uploaded.Mimetype),
+			FileName:        fileName,
+			Title:           fileName,
+			PageCount:       optionalUint32(uploaded.PageCount),
+			URL:             &uploaded.URL,
+			DirectPath:      &uploaded.DirectPath,
+			MediaKey:        uploaded.MediaKey,
+			FileEncSHA256:   uploaded.FileEncSHA256,
+			FileSHA256:      uploaded.FileSHA256,
+			FileLength:      &uploaded.FileLength,
+			JPEGThumbnail:   uploaded.Thumbnail,
+			ThumbnailWidth:  optionalUint32(uploaded.ThumbnailWidth),
+			ThumbnailHeight: optionalUint32(uploaded.ThumbnailHeight),
+		}
+	case __.MediaType_STICKER:
+		message.StickerMessage = &waE2E.StickerMessage{
+			Mimetype:      proto.String(uploaded.Mimetype),
+			URL:           &uploaded.URL,
+			DirectPath:    &uploaded.DirectPath,
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    &uploaded.FileLength,
+			Width:         optionalUint32(uploaded.Width),
+			Height:        optionalUint32(uploaded.Height),
+			IsAnimated:    proto.Bool(uploaded.Animated),
 		}
 	}
+}
 
-	extra := whatsmeow.SendRequestExtra{}
-	if mediaResponse.Handle != "" {
-		// Newsletters
-		extra.MediaHandle = mediaResponse.Handle
+func buildLocationMessage(location *__.Location, comment string) *waE2E.LocationMessage {
+	message := &waE2E.LocationMessage{
+		DegreesLatitude:  proto.Float64(location.Latitude),
+		DegreesLongitude: proto.Float64(location.Longitude),
+	}
+	if location.Name != "" {
+		message.Name = proto.String(location.Name)
 	}
+	if location.Address != "" {
+		message.Address = proto.String(location.Address)
+	}
+	if location.Url != "" {
+		message.URL = proto.String(location.Url)
+	}
+	if comment != "" {
+		message.Comment = proto.String(comment)
+	}
+	return message
+}
 
-	res, err := cli.SendMessage(ctx, jid, &message, extra)
-	if err != nil {
-		return nil, err
+func buildLiveLocationMessage(location *__.LiveLocation, caption string) *waE2E.LiveLocationMessage {
+	message := &waE2E.LiveLocationMessage{
+		DegreesLatitude:                   proto.Float64(location.Latitude),
+		DegreesLongitude:                  proto.Float64(location.Longitude),
+		AccuracyInMeters:                  proto.Uint32(location.Accuracy),
+		SpeedInMps:                        proto.Float32(location.Speed),
+		DegreesClockwiseFromMagneticNorth: proto.Uint32(location.Degrees),
+		SequenceNumber:                    proto.Int64(location.Sequence),
+	}
+	if caption != "" {
+		message.Caption = proto.String(caption)
 	}
+	return message
+}
 
-	return &__.MessageResponse{Id: res.ID, Timestamp: res.Timestamp.Unix()}, nil
+func buildContactMessages(contacts []*__.Contact) []*waE2E.ContactMessage {
+	messages := make([]*waE2E.ContactMessage, len(contacts))
+	for i, contact := range contacts {
+		messages[i] = &waE2E.ContactMessage{
+			DisplayName: proto.String(contact.DisplayName),
+			Vcard:       proto.String(contact.Vcard),
+		}
+	}
+	return messages
 }
 
 func (s *Server) SendReaction(ctx context.Context, req *__.MessageReaction) (*__.MessageResponse, error) {
@@ -209,6 +506,57 @@ func (s *Server) SendReaction(ctx context.Context, req *__.MessageReaction) (*__
 	return &__.MessageResponse{Id: res.ID, Timestamp: res.Timestamp.Unix()}, nil
 }
 
+func (s *Server) EditMessage(ctx context.Context, req *__.EditMessageRequest) (*__.MessageResponse, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := types.ParseJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+
+	content := &waE2E.Message{
+		ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text: proto.String(req.GetText()),
+		},
+	}
+	message := cli.BuildEdit(jid, req.GetMessageId(), content)
+	res, err := cli.SendMessage(ctx, jid, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return &__.MessageResponse{Id: res.ID, Timestamp: res.Timestamp.Unix()}, nil
+}
+
+func (s *Server) RevokeMessage(ctx context.Context, req *__.RevokeMessageRequest) (*__.MessageResponse, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := types.ParseJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+	// Empty sender - own message
+	sender := types.EmptyJID
+	if req.GetSender() != "" {
+		sender, err = types.ParseJID(req.GetSender())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	message := cli.BuildRevoke(jid, sender, req.GetMessageId())
+	res, err := cli.SendMessage(ctx, jid, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return &__.MessageResponse{Id: res.ID, Timestamp: res.Timestamp.Unix()}, nil
+}
+
 func (s *Server) MarkRead(ctx context.Context, req *__.MarkReadRequest) (*__.Empty, error) {
 	cli, err := s.Sm.Get(req.GetSession().GetId())
 	if err != nil {
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"github.com/devlikeapro/gows/gows"
+	__ "github.com/devlikeapro/gows/proto"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func (s *Server) SendPoll(ctx context.Context, req *__.PollRequest) (*__.MessageResponse, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := types.ParseJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+
+	message := cli.BuildPollCreation(req.GetName(), req.GetOptions(), int(req.GetSelectableCount()))
+	res, err := cli.SendMessage(ctx, jid, message)
+	if err != nil {
+		return nil, err
+	}
+	return &__.MessageResponse{Id: res.ID, Timestamp: res.Timestamp.Unix()}, nil
+}
+
+func (s *Server) SendPollVote(ctx context.Context, req *__.PollVoteRequest) (*__.MessageResponse, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	jid, err := types.ParseJID(req.GetJid())
+	if err != nil {
+		return nil, err
+	}
+
+	me := cli.GetOwnId().ToNonAD()
+	sender := me
+	if req.GetPollSender() != "" {
+		sender, err = types.ParseJID(req.GetPollSender())
+		if err != nil {
+			return nil, err
+		}
+		sender = sender.ToNonAD()
+	}
+	pollInfo := &types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     jid,
+			Sender:   sender,
+			IsFromMe: sender == me,
+			IsGroup:  gows.IsGroup(jid),
+		},
+		ID: req.GetPollMessageId(),
+	}
+
+	message, err := cli.BuildPollVote(pollInfo, req.GetOptions())
+	if err != nil {
+		return nil, err
+	}
+	res, err := cli.SendMessage(ctx, jid, message)
+	if err != nil {
+		return nil, err
+	}
+	return &__.MessageResponse{Id: res.ID, Timestamp: res.Timestamp.Unix()}, nil
+}
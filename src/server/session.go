@@ -6,7 +6,10 @@ import (
 	"github.com/devlikeapro/gows/gows"
 	"github.com/devlikeapro/gows/proto"
 	"go.mau.fi/whatsmeow"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"net/url"
+	"time"
 )
 
 func addApplicationName(address string, name string) string {
@@ -45,26 +48,89 @@ func (s *Server) StartSession(ctx context.Context, req *__.StartSessionRequest)
 		Proxy: gows.ProxyConfig{
 			Url: req.Config.Proxy.Url,
 		},
+		Media: gows.MediaConfig{
+			AutoDownload: req.Config.GetMedia().GetAutoDownload(),
+			Mimetypes:    req.Config.GetMedia().GetMimetypes(),
+			MaxSize:      req.Config.GetMedia().GetMaxSize(),
+		},
 	}
-
 	session := req.GetId()
-	cli, err := s.Sm.Start(session, cfg)
+	if directory := req.Config.GetMedia().GetDirectory(); directory != "" {
+		err := gows.ValidatePathName(session)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		cfg.Media.Storage = &gows.LocalMediaStorage{Dir: directory}
+	} else if cfg.Media.AutoDownload {
+		return nil, status.Error(codes.InvalidArgument, "media directory is required for auto download")
+	}
+
+	cli, created, err := s.Sm.Start(session, cfg)
 	if err != nil {
 		return nil, err
 	}
+	if !created {
+		// Already running, events are already issued
+		return &__.Empty{}, nil
+	}
+
+	if req.Config.GetEvents().GetJournal() {
+		retention := time.Duration(req.Config.GetEvents().GetRetentionHours()) * time.Hour
+		err = s.startJournal(session, dialect, address, retention)
+		if err != nil {
+			s.Sm.Stop(session)
+			return nil, err
+		}
+	}
+	if len(req.Config.GetWebhooks()) != 0 {
+		err = s.startWebhooks(session, req.Config.GetWebhooks(), dialect, address)
+		if err != nil {
+			s.Sm.Stop(session)
+			s.stopJournal(session)
+			return nil, err
+		}
+	}
 
+	// Metrics are kept while the session runs, so unknown sessions don't add entries
+	s.getMetrics(session)
+	s.issueLifecycleEvent(session, &gows.SessionStartedEventData{})
 	// Subscribe to events
+	done := make(chan struct{})
+	s.consumersLock.Lock()
+	s.consumers[session] = done
+	s.consumersLock.Unlock()
 	go func() {
+		defer close(done)
 		for evt := range cli.GetEventChannel() {
 			s.IssueEvent(session, evt)
 		}
+		// The channel is closed when the session stops
+		s.issueLifecycleEvent(session, &gows.SessionStoppedEventData{})
 	}()
 
 	return &__.Empty{}, nil
 }
 
 func (s *Server) StopSession(ctx context.Context, req *__.Session) (*__.Empty, error) {
-	s.Sm.Stop(req.GetId())
+	session := req.GetId()
+	s.Sm.Stop(session)
+
+	// Wait for the buffered events, so they reach the journal and webhooks before they're closed
+	s.consumersLock.Lock()
+	done, ok := s.consumers[session]
+	delete(s.consumers, session)
+	s.consumersLock.Unlock()
+	if ok {
+		<-done
+	}
+
+	s.stopJournal(session)
+	s.stopWebhooks(session)
+	s.stopMetrics(session)
+
+	s.uploadsLock.Lock()
+	delete(s.uploads, session)
+	s.uploadsLock.Unlock()
 	return &__.Empty{}, nil
 }
 
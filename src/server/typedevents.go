@@ -0,0 +1,217 @@
+package server
+
+import (
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// typedEventSchemaVersion - version of typed events schema in gows.proto
+const typedEventSchemaVersion = 1
+
+func (s *Server) StreamTypedEvents(req *__.StreamEventsRequest, stream grpc.ServerStreamingServer[__.Event]) error {
+	if req.GetResume() {
+		return status.Error(codes.InvalidArgument, "resume is not supported for typed events")
+	}
+	name := req.GetId()
+	filter, err := newEventFilter(req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	streamId := uuid.New()
+	listener := newEventListener(req.GetQueueSize(), req.GetOverflow(), filter, s.lookupMetrics(name))
+	s.addListener(name, streamId, listener)
+	defer s.removeListener(name, streamId)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-listener.done:
+			return listener.closeError()
+		case event := <-listener.queue:
+			data := s.toTypedEvent(event.Event)
+			if data == nil {
+				continue
+			}
+			data.Session = name
+			data.SchemaVersion = typedEventSchemaVersion
+			data.Sequence = event.Sequence
+			err := stream.Send(data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toTypedEvent converts the event to typed one, returns nil if there's no typed schema for it
+func (s *Server) toTypedEvent(event interface{}) *__.Event {
+	switch evt := event.(type) {
+	case *events.Message:
+		return &__.Event{Event: &__.Event_Message{Message: s.toMessageEvent(evt)}}
+	case *gows.MediaDownloadedEventData:
+		return &__.Event{Event: &__.Event_MediaDownloaded{MediaDownloaded: &__.MediaDownloadedEvent{
+			Info:     toMessageInfo(&evt.Info),
+			Path:     evt.Path,
+			Mimetype: evt.Mimetype,
+			Size:     evt.Size,
+		}}}
+	case *events.Receipt:
+		return &__.Event{Event: &__.Event_Receipt{Receipt: &__.ReceiptEvent{
+			Chat:       evt.Chat.String(),
+			Sender:     evt.Sender.String(),
+			FromMe:     evt.IsFromMe,
+			IsGroup:    evt.IsGroup,
+			MessageIds: evt.MessageIDs,
+			Timestamp:  toUnix(evt.Timestamp),
+			Type:       string(evt.Type),
+		}}}
+	case *events.Presence:
+		return &__.Event{Event: &__.Event_Presence{Presence: &__.PresenceEvent{
+			From:        evt.From.String(),
+			Unavailable: evt.Unavailable,
+			LastSeen:    toUnix(evt.LastSeen),
+		}}}
+	case *events.ChatPresence:
+		return &__.Event{Event: &__.Event_ChatPresence{ChatPresence: &__.ChatPresenceEvent{
+			Chat:    evt.Chat.String(),
+			Sender:  evt.Sender.String(),
+			IsGroup: evt.IsGroup,
+			State:   string(evt.State),
+			Media:   string(evt.Media),
+		}}}
+	case *gows.ConnectedEventData:
+		connected := &__.ConnectedEvent{PushName: evt.PushName}
+		if evt.ID != nil {
+			connected.Id = evt.ID.String()
+		}
+		return &__.Event{Event: &__.Event_Connected{Connected: connected}}
+	case *events.Disconnected:
+		return &__.Event{Event: &__.Event_Disconnected{Disconnected: &__.DisconnectedEvent{}}}
+	case *events.LoggedOut:
+		return &__.Event{Event: &__.Event_LoggedOut{LoggedOut: &__.LoggedOutEvent{
+			OnConnect: evt.OnConnect,
+			Reason:    int32(evt.Reason),
+		}}}
+	case whatsmeow.QRChannelItem:
+		return &__.Event{Event: &__.Event_Qr{Qr: &__.QRCodeEvent{
+			Event:   evt.Event,
+			Code:    evt.Code,
+			Timeout: int64(evt.Timeout / time.Second),
+		}}}
+	case *events.PairSuccess:
+		return &__.Event{Event: &__.Event_PairSuccess{PairSuccess: &__.PairSuccessEvent{
+			Id:           evt.ID.String(),
+			BusinessName: evt.BusinessName,
+			Platform:     evt.Platform,
+		}}}
+	case *events.GroupInfo:
+		return &__.Event{Event: &__.Event_GroupInfo{GroupInfo: toGroupInfoEvent(evt)}}
+	case *gows.PollVoteEventData:
+		return &__.Event{Event: &__.Event_PollVote{PollVote: &__.PollVoteEvent{
+			Info:            toMessageInfo(&evt.Info),
+			PollId:          evt.PollID,
+			Voter:           evt.Voter.String(),
+			SelectedOptions: evt.SelectedOptions,
+			Unresolved:      evt.Unresolved,
+			SelectedHashes:  evt.SelectedHashes,
+		}}}
+	}
+	return nil
+}
+
+func (s *Server) toMessageEvent(evt *events.Message) *__.MessageEvent {
+	message, err := proto.Marshal(evt.Message)
+	if err != nil {
+		s.log.Errorf("Error when marshaling message: %v", err)
+	}
+	return &__.MessageEvent{
+		Info:    toMessageInfo(&evt.Info),
+		Message: message,
+		Text:    getMessageText(evt.Message),
+	}
+}
+
+func toMessageInfo(info *types.MessageInfo) *__.MessageInfo {
+	return &__.MessageInfo{
+		Id:        info.ID,
+		Chat:      info.Chat.String(),
+		Sender:    info.Sender.String(),
+		FromMe:    info.IsFromMe,
+		IsGroup:   info.IsGroup,
+		Timestamp: toUnix(info.Timestamp),
+		PushName:  info.PushName,
+		Type:      info.Type,
+		MediaType: info.MediaType,
+		Edit:      string(info.Edit),
+	}
+}
+
+// getMessageText gets the text or the caption of the message
+func getMessageText(msg *waE2E.Message) string {
+	switch {
+	case msg.GetConversation() != "":
+		return msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	}
+	return ""
+}
+
+func toGroupInfoEvent(evt *events.GroupInfo) *__.GroupInfoEvent {
+	info := &__.GroupInfoEvent{
+		Jid:       evt.JID.String(),
+		Timestamp: toUnix(evt.Timestamp),
+		Join:      toJIDStrings(evt.Join),
+		Leave:     toJIDStrings(evt.Leave),
+		Promote:   toJIDStrings(evt.Promote),
+		Demote:    toJIDStrings(evt.Demote),
+	}
+	if evt.Sender != nil {
+		info.Sender = evt.Sender.String()
+	}
+	if evt.Name != nil {
+		info.Name = &__.OptionalString{Value: evt.Name.Name}
+	}
+	if evt.Topic != nil {
+		info.Topic = &__.OptionalString{Value: evt.Topic.Topic}
+	}
+	if evt.Locked != nil {
+		info.Locked = &__.OptionalBool{Value: evt.Locked.IsLocked}
+	}
+	if evt.Announce != nil {
+		info.Announce = &__.OptionalBool{Value: evt.Announce.IsAnnounce}
+	}
+	return info
+}
+
+func toJIDStrings(jids []types.JID) []string {
+	result := make([]string, len(jids))
+	for i, jid := range jids {
+		result[i] = jid.String()
+	}
+	return result
+}
+
+// toUnix converts time to unix seconds, 0 for zero time
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/devlikeapro/gows/gows"
+	__ "github.com/devlikeapro/gows/proto"
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"sync"
+	"time"
+)
+
+// uploadedMediaTTL - how long uploaded media can be sent again
+const uploadedMediaTTL = 24 * time.Hour
+
+// uploadedMediaCapacity - how many handles from UploadMedia are kept per session
+const uploadedMediaCapacity = 1000
+
+// contentUploadsCapacity - how many uploads are kept per session to not upload the same content again
+const contentUploadsCapacity = 100
+
+var ErrMediaHandleNotFound = errors.New("media handle not found or expired")
+
+// uploadedMedia is media uploaded to WhatsApp in advance, so it can be sent again without uploading
+type uploadedMedia struct {
+	whatsmeow.UploadResponse
+	Type      __.MediaType
+	Mimetype  string
+	Filename  string
+	Thumbnail []byte
+
+	// Metadata, 0 - unknown
+	Width           uint32
+	Height          uint32
+	Seconds         uint32
+	Waveform        []byte
+	PageCount       uint32
+	ThumbnailWidth  uint32
+	ThumbnailHeight uint32
+	Animated        bool
+	// video, lets clients play it while downloading
+	StreamingSidecar []byte
+
+	created time.Time
+}
+
+type uploadEntry struct {
+	key   string
+	media *uploadedMedia
+}
+
+// uploadStore keeps the recently used uploads
+type uploadStore struct {
+	lock     sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	// front - the most recently used
+	order *list.List
+}
+
+func newUploadStore(capacity int) *uploadStore {
+	return &uploadStore{
+		capacity: capacity,
+		items:    map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+func (us *uploadStore) put(key string, media *uploadedMedia) {
+	us.lock.Lock()
+	defer us.lock.Unlock()
+
+	media.created = time.Now()
+	if element, ok := us.items[key]; ok {
+		element.Value.(*uploadEntry).media = media
+		us.order.MoveToFront(element)
+		return
+	}
+	us.items[key] = us.order.PushFront(&uploadEntry{key: key, media: media})
+	for us.order.Len() > us.capacity {
+		oldest := us.order.Back()
+		us.order.Remove(oldest)
+		delete(us.items, oldest.Value.(*uploadEntry).key)
+	}
+}
+
+func (us *uploadStore) get(key string) (*uploadedMedia, error) {
+	us.lock.Lock()
+	defer us.lock.Unlock()
+	element, ok := us.items[key]
+	if !ok {
+		return nil, ErrMediaHandleNotFound
+	}
+	entry := element.Value.(*uploadEntry)
+	if time.Since(entry.media.created) > uploadedMediaTTL {
+		us.order.Remove(element)
+		delete(us.items, key)
+		return nil, ErrMediaHandleNotFound
+	}
+	us.order.MoveToFront(element)
+	return entry.media, nil
+}
+
+// add saves uploaded media and returns the handle for it
+func (us *uploadStore) add(media *uploadedMedia) string {
+	id := uuid.New().String()
+	us.put(id, media)
+	return id
+}
+
+// sessionUploads keeps the uploads of one session
+type sessionUploads struct {
+	// by handle from UploadMedia
+	handles *uploadStore
+	// by content hash, so the same content is not uploaded again
+	contents *uploadStore
+}
+
+func (s *Server) getUploads(session string) *sessionUploads {
+	s.uploadsLock.Lock()
+	defer s.uploadsLock.Unlock()
+	uploads, ok := s.uploads[session]
+	if !ok {
+		uploads = &sessionUploads{
+			handles:  newUploadStore(uploadedMediaCapacity),
+			contents: newUploadStore(contentUploadsCapacity),
+		}
+		s.uploads[session] = uploads
+	}
+	return uploads
+}
+
+// contentKey identifies the request content together with the options changing its processing
+func contentKey(reqMedia *__.Media) string {
+	return fmt.Sprintf(
+		"%x/%s/%s/%t/%d/%d",
+		sha256.Sum256(reqMedia.Content),
+		reqMedia.Type,
+		reqMedia.Mimetype,
+		reqMedia.Convert,
+		reqMedia.GetImage().GetMaxSide(),
+		reqMedia.GetImage().GetMaxBytes(),
+	)
+}
+
+// uploadMedia processes and uploads the media or reuses the previous upload of the same content,
+// so the same content is not converted and uploaded again
+func (s *Server) uploadMedia(ctx context.Context, cli *gows.GoWS, jid types.JID, reqMedia *__.Media) (*uploadedMedia, error) {
+	// Newsletter media handles are not reused
+	if gows.IsNewsletter(jid) {
+		return s.processMedia(ctx, cli, jid, reqMedia)
+	}
+
+	session, _ := cli.Context.Value("name").(string)
+	contents := s.getUploads(session).contents
+	key := contentKey(reqMedia)
+	previous, err := contents.get(key)
+	if err == nil {
+		uploaded := *previous
+		uploaded.Filename = reqMedia.Filename
+		return &uploaded, nil
+	}
+	uploaded, err := s.processMedia(ctx, cli, jid, reqMedia)
+	if err != nil {
+		return nil, err
+	}
+	contents.put(key, uploaded)
+	return uploaded, nil
+}
+
+func toWhatsmeowMediaType(mediaType __.MediaType) (whatsmeow.MediaType, error) {
+	switch mediaType {
+	case __.MediaType_IMAGE, __.MediaType_STICKER:
+		return whatsmeow.MediaImage, nil
+	case __.MediaType_AUDIO:
+		return whatsmeow.MediaAudio, nil
+	case __.MediaType_VIDEO:
+		return whatsmeow.MediaVideo, nil
+	case __.MediaType_DOCUMENT:
+		return whatsmeow.MediaDocument, nil
+	default:
+		return "", errors.New("invalid media type: " + mediaType.String())
+	}
+}
+
+func toMediaReference(uploaded *uploadedMedia) *__.MediaReference {
+	return &__.MediaReference{
+		Type:             uploaded.Type,
+		Mimetype:         uploaded.Mimetype,
+		Url:              uploaded.URL,
+		DirectPath:       uploaded.DirectPath,
+		MediaKey:         uploaded.MediaKey,
+		FileEncSha256:    uploaded.FileEncSHA256,
+		FileSha256:       uploaded.FileSHA256,
+		FileLength:       uploaded.FileLength,
+		Thumbnail:        uploaded.Thumbnail,
+		Filename:         uploaded.Filename,
+		Handle:           uploaded.Handle,
+		Width:            uploaded.Width,
+		Height:           uploaded.Height,
+		Seconds:          uploaded.Seconds,
+		Waveform:         uploaded.Waveform,
+		PageCount:        uploaded.PageCount,
+		ThumbnailWidth:   uploaded.ThumbnailWidth,
+		ThumbnailHeight:  uploaded.ThumbnailHeight,
+		Animated:         uploaded.Animated,
+		StreamingSidecar: uploaded.StreamingSidecar,
+	}
+}
+
+func fromMediaReference(ref *__.MediaReference) *uploadedMedia {
+	return &uploadedMedia{
+		UploadResponse: whatsmeow.UploadResponse{
+			URL:           ref.GetUrl(),
+			DirectPath:    ref.GetDirectPath(),
+			Handle:        ref.GetHandle(),
+			MediaKey:      ref.GetMediaKey(),
+			FileEncSHA256: ref.GetFileEncSha256(),
+			FileSHA256:    ref.GetFileSha256(),
+			FileLength:    ref.GetFileLength(),
+		},
+		Type:             ref.GetType(),
+		Mimetype:         ref.GetMimetype(),
+		Filename:         ref.GetFilename(),
+		Thumbnail:        ref.GetThumbnail(),
+		Width:            ref.GetWidth(),
+		Height:           ref.GetHeight(),
+		Seconds:          ref.GetSeconds(),
+		Waveform:         ref.GetWaveform(),
+		PageCount:        ref.GetPageCount(),
+		ThumbnailWidth:   ref.GetThumbnailWidth(),
+		ThumbnailHeight:  ref.GetThumbnailHeight(),
+		Animated:         ref.GetAnimated(),
+		StreamingSidecar: ref.GetStreamingSidecar(),
+	}
+}
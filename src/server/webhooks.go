@@ -0,0 +1,357 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/google/uuid"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// webhookRetries - how many times the delivery is retried by default
+const webhookRetries = 5
+
+// webhookQueueSize - how many events can wait for the delivery, the rest go to dead letters
+const webhookQueueSize = 1000
+
+const webhookTimeout = 30 * time.Second
+const webhookMinBackoff = 1 * time.Second
+const webhookMaxBackoff = 1 * time.Minute
+
+var ErrWebhooksDisabled = errors.New("webhooks are not configured for the session")
+var ErrWebhookQueueFull = errors.New("webhook queue is full")
+
+var deadLettersSchema = []string{
+	`CREATE TABLE IF NOT EXISTS gows_webhook_dead_letters (
+		id         TEXT   PRIMARY KEY,
+		session    TEXT   NOT NULL,
+		url        TEXT   NOT NULL,
+		body       TEXT   NOT NULL,
+		error      TEXT   NOT NULL,
+		created_at BIGINT NOT NULL
+	)`,
+}
+
+// deadLetterStore keeps the events that could not be delivered to webhooks
+type deadLetterStore struct {
+	db      *sql.DB
+	session string
+}
+
+func openDeadLetterStore(dialect string, address string, session string) (*deadLetterStore, error) {
+	db, err := sql.Open(dialect, address)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range deadLettersSchema {
+		_, err = db.Exec(query)
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	return &deadLetterStore{db: db, session: session}, nil
+}
+
+func (ds *deadLetterStore) add(url string, body []byte, reason error) error {
+	_, err := ds.db.Exec(
+		"INSERT INTO gows_webhook_dead_letters (id, session, url, body, error, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		uuid.New().String(), ds.session, url, string(body), reason.Error(), time.Now().Unix(),
+	)
+	return err
+}
+
+func (ds *deadLetterStore) list(limit uint32) ([]*__.WebhookDeadLetter, error) {
+	rows, err := ds.db.Query(
+		"SELECT id, url, body, error, created_at FROM gows_webhook_dead_letters WHERE session = $1 ORDER BY created_at LIMIT $2",
+		ds.session, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	letters := make([]*__.WebhookDeadLetter, 0)
+	for rows.Next() {
+		letter := &__.WebhookDeadLetter{}
+		err = rows.Scan(&letter.Id, &letter.Url, &letter.Body, &letter.Error, &letter.Created)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
+
+func (ds *deadLetterStore) remove(ids []string) error {
+	for _, id := range ids {
+		_, err := ds.db.Exec(
+			"DELETE FROM gows_webhook_dead_letters WHERE session = $1 AND id = $2",
+			ds.session, id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ds *deadLetterStore) close() error {
+	return ds.db.Close()
+}
+
+// signWebhook signs the body with HMAC-SHA512
+func signWebhook(key []byte, body []byte) string {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff - exponential delay before the retry attempt
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookMinBackoff << attempt
+	if backoff <= 0 || backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
+
+// webhook delivers events to one URL, in order
+type webhook struct {
+	url     string
+	events  map[string]bool
+	hmacKey []byte
+	retries int
+
+	queue       chan []byte
+	client      *http.Client
+	deadLetters *deadLetterStore
+	log         waLog.Logger
+}
+
+func newWebhook(cfg *__.SessionWebhookConfig, client *http.Client, deadLetters *deadLetterStore, log waLog.Logger) *webhook {
+	retries := webhookRetries
+	if cfg.Retries != nil {
+		retries = int(cfg.Retries.Value)
+	}
+	var hmacKey []byte
+	if cfg.HmacKey != "" {
+		hmacKey = []byte(cfg.HmacKey)
+	}
+	return &webhook{
+		url:         cfg.Url,
+		events:      toSet(cfg.Events),
+		hmacKey:     hmacKey,
+		retries:     retries,
+		queue:       make(chan []byte, webhookQueueSize),
+		client:      client,
+		deadLetters: deadLetters,
+		log:         log,
+	}
+}
+
+// send queues the event body, it's dead-lettered if the queue is full
+func (w *webhook) send(eventType string, body []byte) {
+	if w.events != nil && !w.events[eventType] {
+		return
+	}
+	select {
+	case w.queue <- body:
+	default:
+		w.fail(body, ErrWebhookQueueFull)
+	}
+}
+
+func (w *webhook) fail(body []byte, reason error) {
+	w.log.Errorf("Failed to deliver event to webhook %s: %v", w.url, reason)
+	err := w.deadLetters.add(w.url, body, reason)
+	if err != nil {
+		w.log.Errorf("Failed to save dead letter: %v", err)
+	}
+}
+
+// run delivers the queued events until the context is done,
+// the undelivered ones go to dead letters
+func (w *webhook) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			w.drain(ctx.Err())
+			return
+		case body := <-w.queue:
+			err := w.deliver(ctx, body)
+			if err != nil {
+				w.fail(body, err)
+			}
+		}
+	}
+}
+
+func (w *webhook) drain(reason error) {
+	for {
+		select {
+		case body := <-w.queue:
+			w.fail(body, reason)
+		default:
+			return
+		}
+	}
+}
+
+// deliver posts the body, retrying with exponential backoff
+func (w *webhook) deliver(ctx context.Context, body []byte) error {
+	var err error
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+			case <-time.After(webhookBackoff(attempt - 1)):
+			}
+		}
+		err = w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		w.log.Warnf("Webhook %s attempt %d failed: %v", w.url, attempt+1, err)
+	}
+	return err
+}
+
+func (w *webhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Request-Id", uuid.New().String())
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	if w.hmacKey != nil {
+		req.Header.Set("X-Webhook-Hmac", signWebhook(w.hmacKey, body))
+		req.Header.Set("X-Webhook-Hmac-Algorithm", "sha512")
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookSender delivers the session events to its webhooks
+type webhookSender struct {
+	webhooks    []*webhook
+	deadLetters *deadLetterStore
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+func newWebhookSender(cfgs []*__.SessionWebhookConfig, client *http.Client, deadLetters *deadLetterStore, log waLog.Logger) *webhookSender {
+	ctx, cancel := context.WithCancel(context.Background())
+	sender := &webhookSender{deadLetters: deadLetters, cancel: cancel}
+	for _, cfg := range cfgs {
+		hook := newWebhook(cfg, client, deadLetters, log)
+		sender.webhooks = append(sender.webhooks, hook)
+		sender.wg.Add(1)
+		go func() {
+			defer sender.wg.Done()
+			hook.run(ctx)
+		}()
+	}
+	return sender
+}
+
+// send sends the event in EventJson format
+func (ws *webhookSender) send(event *__.EventJson) {
+	// The same JSON as for EventJson in the streams
+	body, err := protojson.Marshal(event)
+	if err != nil {
+		return
+	}
+	for _, hook := range ws.webhooks {
+		hook.send(event.Event, body)
+	}
+}
+
+func (ws *webhookSender) stop() error {
+	ws.cancel()
+	ws.wg.Wait()
+	return ws.deadLetters.close()
+}
+
+func (s *Server) getWebhooks(session string) *webhookSender {
+	s.webhooksLock.RLock()
+	defer s.webhooksLock.RUnlock()
+	return s.webhooks[session]
+}
+
+func (s *Server) startWebhooks(session string, cfgs []*__.SessionWebhookConfig, dialect string, address string) error {
+	s.webhooksLock.Lock()
+	defer s.webhooksLock.Unlock()
+	if _, ok := s.webhooks[session]; ok {
+		return nil
+	}
+	deadLetters, err := openDeadLetterStore(dialect, address, session)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	s.webhooks[session] = newWebhookSender(cfgs, client, deadLetters, s.log.Sub("Webhooks"))
+	return nil
+}
+
+func (s *Server) stopWebhooks(session string) {
+	s.webhooksLock.Lock()
+	sender, ok := s.webhooks[session]
+	delete(s.webhooks, session)
+	s.webhooksLock.Unlock()
+	if !ok {
+		return
+	}
+	err := sender.stop()
+	if err != nil {
+		s.log.Errorf("Error stopping webhooks: %v", err)
+	}
+}
+
+// deadLettersLimit - how many dead letters are returned at once
+const deadLettersLimit = 100
+
+func (s *Server) GetWebhookDeadLetters(ctx context.Context, req *__.Session) (*__.WebhookDeadLetterList, error) {
+	sender := s.getWebhooks(req.GetId())
+	if sender == nil {
+		return nil, status.Error(codes.FailedPrecondition, ErrWebhooksDisabled.Error())
+	}
+	letters, err := sender.deadLetters.list(deadLettersLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &__.WebhookDeadLetterList{DeadLetters: letters}, nil
+}
+
+func (s *Server) DeleteWebhookDeadLetters(ctx context.Context, req *__.DeleteWebhookDeadLettersRequest) (*__.Empty, error) {
+	sender := s.getWebhooks(req.GetSession().GetId())
+	if sender == nil {
+		return nil, status.Error(codes.FailedPrecondition, ErrWebhooksDisabled.Error())
+	}
+	err := sender.deadLetters.remove(req.GetIds())
+	if err != nil {
+		return nil, err
+	}
+	return &__.Empty{}, nil
+}
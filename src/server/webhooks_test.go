@@ -0,0 +1,182 @@
+package server
+
+import (
+	gowsLog "github.com/devlikeapro/gows/log"
+	"github.com/devlikeapro/gows/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRecorder is the webhook endpoint that fails the first requests
+type webhookRecorder struct {
+	lock     sync.Mutex
+	failures int
+	attempts int
+	bodies   []string
+	headers  []http.Header
+}
+
+func (wr *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+	wr.attempts++
+	if wr.attempts <= wr.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	wr.bodies = append(wr.bodies, string(body))
+	wr.headers = append(wr.headers, r.Header.Clone())
+	w.WriteHeader(http.StatusOK)
+}
+
+func (wr *webhookRecorder) delivered() ([]string, []http.Header) {
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+	return wr.bodies, wr.headers
+}
+
+func newTestWebhookSender(t *testing.T, cfgs ...*__.SessionWebhookConfig) *webhookSender {
+	t.Helper()
+	address := filepath.Join(t.TempDir(), "gows.db") + "?_foreign_keys=on"
+	deadLetters, err := openDeadLetterStore("sqlite3", address, "default")
+	if err != nil {
+		t.Fatalf("failed to open dead letters: %v", err)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	return newWebhookSender(cfgs, client, deadLetters, gowsLog.Stdout("Webhooks", "ERROR", false))
+}
+
+// waitFor waits until the condition is met
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the webhook")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testEvent(eventType string) *__.EventJson {
+	return &__.EventJson{Session: "default", Event: eventType, Data: `{"id":"1"}`}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	recorder := &webhookRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+	sender := newTestWebhookSender(t, &__.SessionWebhookConfig{Url: server.URL, HmacKey: "secret"})
+	defer sender.stop()
+
+	event := testEvent("events.Message")
+	sender.send(event)
+	waitFor(t, 5*time.Second, func() bool {
+		bodies, _ := recorder.delivered()
+		return len(bodies) == 1
+	})
+
+	bodies, headers := recorder.delivered()
+	var delivered __.EventJson
+	err := protojson.Unmarshal([]byte(bodies[0]), &delivered)
+	if err != nil || !proto.Equal(&delivered, event) {
+		t.Errorf("unexpected body: %s", bodies[0])
+	}
+	if headers[0].Get("X-Webhook-Hmac") != signWebhook([]byte("secret"), []byte(bodies[0])) {
+		t.Errorf("invalid signature: %s", headers[0].Get("X-Webhook-Hmac"))
+	}
+	if headers[0].Get("X-Webhook-Hmac-Algorithm") != "sha512" {
+		t.Errorf("unexpected algorithm: %s", headers[0].Get("X-Webhook-Hmac-Algorithm"))
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	recorder := &webhookRecorder{failures: 1}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+	sender := newTestWebhookSender(t, &__.SessionWebhookConfig{Url: server.URL})
+	defer sender.stop()
+
+	sender.send(testEvent("events.Message"))
+	waitFor(t, 5*time.Second, func() bool {
+		bodies, _ := recorder.delivered()
+		return len(bodies) == 1
+	})
+
+	letters, err := sender.deadLetters.list(deadLettersLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 {
+		t.Errorf("expected no dead letters, got %d", len(letters))
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	recorder := &webhookRecorder{failures: 100}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+	sender := newTestWebhookSender(t, &__.SessionWebhookConfig{
+		Url:     server.URL,
+		Retries: &__.OptionalUInt32{Value: 1},
+	})
+	defer sender.stop()
+
+	sender.send(testEvent("events.Message"))
+	var letters []*__.WebhookDeadLetter
+	waitFor(t, 5*time.Second, func() bool {
+		var err error
+		letters, err = sender.deadLetters.list(deadLettersLimit)
+		return err == nil && len(letters) == 1
+	})
+
+	recorder.lock.Lock()
+	attempts := recorder.attempts
+	recorder.lock.Unlock()
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+	if letters[0].Url != server.URL {
+		t.Errorf("unexpected url: %s", letters[0].Url)
+	}
+}
+
+func TestWebhookEventFilter(t *testing.T) {
+	recorder := &webhookRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+	sender := newTestWebhookSender(t, &__.SessionWebhookConfig{
+		Url:    server.URL,
+		Events: []string{"events.Message"},
+	})
+
+	sender.send(testEvent("events.Receipt"))
+	sender.send(testEvent("events.Message"))
+	waitFor(t, 5*time.Second, func() bool {
+		bodies, _ := recorder.delivered()
+		return len(bodies) == 1
+	})
+	// Nothing else is delivered after the stop
+	err := sender.stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies, _ := recorder.delivered()
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(bodies))
+	}
+	var event __.EventJson
+	_ = protojson.Unmarshal([]byte(bodies[0]), &event)
+	if event.Event != "events.Message" {
+		t.Errorf("unexpected event: %s", event.Event)
+	}
+}